@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FlockMetrics summarizes how ordered the flock of one Sky is
+type FlockMetrics struct {
+	Polarization        float64 // length of the mean heading (unit velocity): 1 when every boid flies the same way, near 0 when headings are random
+	Milling             float64 // length of the mean normalized angular momentum about the centroid: 1 when every boid circles the centroid the same way
+	MeanNearestNeighbor float64 // mean distance from each boid to its nearest other boid
+	MeanSpeed           float64
+	MeanNeighbors       float64 // mean number of other boids within proximity
+	NumFlocks           int     // number of flocks found by FindFlocks, lone boids included
+	LargestFlock        int     // number of boids in the largest flock
+	Captures            int     // number of boids caught by predators so far
+}
+
+// metricsHeader is the first line of a metrics CSV file
+const metricsHeader = "generation,polarization,milling,meanNearestNeighbor,meanSpeed,meanNeighbors,numFlocks,largestFlock,captures"
+
+// MetricNames are the names of the flock metrics, in the order of MetricValues and of the metrics CSV columns
+var MetricNames = strings.Split(metricsHeader, ",")[1:]
+
+// MetricValues returns the flock metrics as numbers, in the order of MetricNames
+func MetricValues(metrics FlockMetrics) []float64 {
+	return []float64{metrics.Polarization, metrics.Milling, metrics.MeanNearestNeighbor, metrics.MeanSpeed,
+		metrics.MeanNeighbors, float64(metrics.NumFlocks), float64(metrics.LargestFlock), float64(metrics.Captures)}
+}
+
+// ComputeFlockMetrics returns the order parameters of current_sky.
+// Distances and the centroid respect the edges of the sky, so a flock crossing a wrapped edge is not torn apart.
+// With fewer than two boids the nearest-neighbor distance is 0.
+func ComputeFlockMetrics(current_sky Sky) FlockMetrics {
+	if current_sky.grid == nil && len(current_sky.boids) > 0 {
+		current_sky.grid = BuildSpatialGrid(current_sky)
+	}
+	return FlockMetricsOf(current_sky, FindFlocks(current_sky))
+}
+
+// FlockMetricsOf returns the order parameters of current_sky, whose flocks, as found by FindFlocks, are flocks
+func FlockMetricsOf(current_sky Sky, flocks []Flock) FlockMetrics {
+	var metrics FlockMetrics
+	metrics.Captures = current_sky.captures
+	n := len(current_sky.boids)
+
+	if n == 0 {
+		return metrics
+	}
+
+	if current_sky.grid == nil {
+		current_sky.grid = BuildSpatialGrid(current_sky)
+	}
+
+	centroid := SkyCentroid(current_sky)
+
+	var heading_sum OrderedPair
+	momentum := 0.0
+	nearest_sum := 0.0
+	neighbor_count := 0
+
+	for _, b := range current_sky.boids {
+		speed := math.Sqrt(b.velocity.x*b.velocity.x + b.velocity.y*b.velocity.y)
+		metrics.MeanSpeed += speed
+
+		if speed > 0 {
+			unit := OrderedPair{x: b.velocity.x / speed, y: b.velocity.y / speed}
+			heading_sum.x += unit.x
+			heading_sum.y += unit.y
+
+			// offset from the centroid to the boid, through the nearest edge on a wrapping sky
+			image := MinimumImage(current_sky, centroid, b.position)
+			r := OrderedPair{x: image.x - centroid.x, y: image.y - centroid.y}
+			r_length := math.Sqrt(r.x*r.x + r.y*r.y)
+			if r_length > 0 {
+				momentum += (r.x*unit.y - r.y*unit.x) / r_length
+			}
+		}
+
+		if n > 1 {
+			nearest, neighbors := NearestNeighbor(current_sky, b)
+			nearest_sum += nearest
+			neighbor_count += neighbors
+		}
+	}
+
+	metrics.Polarization = math.Sqrt(heading_sum.x*heading_sum.x+heading_sum.y*heading_sum.y) / float64(n)
+	metrics.Milling = math.Abs(momentum) / float64(n)
+	metrics.MeanSpeed /= float64(n)
+	metrics.MeanNeighbors = float64(neighbor_count) / float64(n)
+	if n > 1 {
+		metrics.MeanNearestNeighbor = nearest_sum / float64(n)
+	}
+
+	metrics.NumFlocks = len(flocks)
+	metrics.LargestFlock = len(flocks[0].Members)
+
+	return metrics
+}
+
+// NearestNeighbor returns the distance from b to the nearest other boid of current_sky, and the number of other boids within proximity.
+// The spatial grid of current_sky (which must be built) answers most queries; a boid with no other boid within
+// proximity falls back to scanning the whole sky.
+func NearestNeighbor(current_sky Sky, b Boid) (float64, int) {
+	nearest := math.Inf(1)
+	neighbors := 0
+
+	for _, i := range NeighborCandidates(current_sky, b.position) {
+		other := current_sky.boids[i]
+		if other.id == b.id {
+			continue
+		}
+
+		d := Distance(b.position, MinimumImage(current_sky, b.position, other.position))
+		nearest = math.Min(nearest, d)
+		if d < current_sky.proximity {
+			neighbors++
+		}
+	}
+
+	if nearest >= current_sky.proximity {
+		for _, other := range current_sky.boids {
+			if other.id != b.id {
+				nearest = math.Min(nearest, Distance(b.position, MinimumImage(current_sky, b.position, other.position)))
+			}
+		}
+	}
+
+	return nearest, neighbors
+}
+
+// SkyCentroid returns the center of the flock of current_sky.
+// On a wrapping sky each coordinate is averaged as an angle around the sky (a circular mean),
+// so that boids on both sides of an edge have their centroid at the edge rather than in the middle of the sky.
+func SkyCentroid(current_sky Sky) OrderedPair {
+	if current_sky.boundary != WrapBoundary || len(current_sky.boids) == 0 {
+		return FlockCentroid(current_sky.boids)
+	}
+
+	var cos_x, sin_x, cos_y, sin_y float64
+	for _, b := range current_sky.boids {
+		theta_x := 2 * math.Pi * b.position.x / current_sky.width
+		theta_y := 2 * math.Pi * b.position.y / current_sky.height
+		cos_x += math.Cos(theta_x)
+		sin_x += math.Sin(theta_x)
+		cos_y += math.Cos(theta_y)
+		sin_y += math.Sin(theta_y)
+	}
+
+	centroid := OrderedPair{
+		x: math.Atan2(sin_x, cos_x) / (2 * math.Pi) * current_sky.width,
+		y: math.Atan2(sin_y, cos_y) / (2 * math.Pi) * current_sky.height,
+	}
+
+	return OrderedPair{x: WrapCoordinate(centroid.x, current_sky.width), y: WrapCoordinate(centroid.y, current_sky.height)}
+}
+
+// MetricsWriter writes the FlockMetrics of every sampled generation as one CSV row
+type MetricsWriter struct {
+	SeriesFile
+}
+
+// MetricsFile returns the name of the metrics CSV file for the output file prefix output_file
+func MetricsFile(output_file string) string {
+	return output_file + ".metrics.csv"
+}
+
+// CreateMetrics creates filename and writes the CSV header
+func CreateMetrics(filename string) (*MetricsWriter, error) {
+	file, err := CreateSeriesFile(filename, metricsHeader+"\n")
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsWriter{SeriesFile: file}, nil
+}
+
+// OpenMetrics reopens the metrics file of an interrupted run, keeping its first size bytes (as returned by Size)
+func OpenMetrics(filename string, size int64) (*MetricsWriter, error) {
+	file, err := ReopenSeriesFile(filename, size)
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsWriter{SeriesFile: file}, nil
+}
+
+// WriteSky writes the metrics of the sky of frame
+func (m *MetricsWriter) WriteSky(frame *SeriesFrame) error {
+	flocks := frame.Flocks()
+	metrics := FlockMetricsOf(frame.Sky, flocks)
+
+	row := []string{strconv.Itoa(frame.Generation)}
+	for _, value := range MetricValues(metrics) {
+		row = append(row, FormatFloat(value))
+	}
+	m.w.WriteString(strings.Join(row, ","))
+	m.w.WriteByte('\n')
+
+	return m.w.Flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestFlockMetrics checks the metrics of flocks whose order is known: an aligned flock, a milling ring and a random sky
+func TestFlockMetrics(t *testing.T) {
+	sky := Sky{width: 1000, height: 1000, proximity: 25}
+
+	// a ring of radius 100 around the middle of the sky, every boid flying the same way
+	for i := 0; i < 36; i++ {
+		theta := 2 * math.Pi * float64(i) / 36
+		sky.boids = append(sky.boids, Boid{id: i,
+			position: OrderedPair{x: 500 + 100*math.Cos(theta), y: 500 + 100*math.Sin(theta)},
+			velocity: OrderedPair{x: 2, y: 0}})
+	}
+
+	metrics := ComputeFlockMetrics(sky)
+	if math.Abs(metrics.Polarization-1) > 1e-12 || math.Abs(metrics.MeanSpeed-2) > 1e-12 {
+		t.Errorf("aligned flock: polarization %v, mean speed %v, want 1 and 2", metrics.Polarization, metrics.MeanSpeed)
+	}
+	if metrics.Milling > 1e-9 {
+		t.Errorf("aligned flock: milling %v, want 0", metrics.Milling)
+	}
+
+	// neighbors on the ring are 2*100*sin(5 degrees) apart, so each boid has two neighbors within proximity
+	spacing := 200 * math.Sin(math.Pi/36)
+	if math.Abs(metrics.MeanNearestNeighbor-spacing) > 1e-9 || metrics.MeanNeighbors != 2 {
+		t.Errorf("ring: mean nearest neighbor %v and mean neighbors %v, want %v and 2", metrics.MeanNearestNeighbor, metrics.MeanNeighbors, spacing)
+	}
+
+	// the same ring circling its center, shifted across the corner of the wrapping sky
+	for i := range sky.boids {
+		theta := 2 * math.Pi * float64(i) / 36
+		sky.boids[i].position = OrderedPair{x: WrapCoordinate(100*math.Cos(theta), 1000), y: WrapCoordinate(100*math.Sin(theta), 1000)}
+		sky.boids[i].velocity = OrderedPair{x: -math.Sin(theta), y: math.Cos(theta)}
+	}
+
+	metrics = ComputeFlockMetrics(sky)
+	if math.Abs(metrics.Milling-1) > 1e-9 || metrics.Polarization > 1e-9 {
+		t.Errorf("milling ring: milling %v, polarization %v, want 1 and 0", metrics.Milling, metrics.Polarization)
+	}
+	if math.Abs(metrics.MeanNearestNeighbor-spacing) > 1e-9 {
+		t.Errorf("milling ring: mean nearest neighbor %v, want %v", metrics.MeanNearestNeighbor, spacing)
+	}
+
+	// a random sky has no order, and the grid gives the same nearest neighbors as a full scan
+	random_sky := GenerateRandomSky(400, 2000, 1000, 1.0, 2.0, 30, 1.5, 1.0, 0.02, 8)
+	metrics = ComputeFlockMetrics(random_sky)
+	if metrics.Polarization > 0.2 || metrics.Milling > 0.2 {
+		t.Errorf("random sky: polarization %v, milling %v", metrics.Polarization, metrics.Milling)
+	}
+
+	nearest_sum := 0.0
+	for _, b := range random_sky.boids {
+		nearest := math.Inf(1)
+		for _, other := range random_sky.boids {
+			if other.id != b.id {
+				nearest = math.Min(nearest, ToroidalDistance(b.position, other.position, random_sky.width, random_sky.height))
+			}
+		}
+		nearest_sum += nearest
+	}
+	if want := nearest_sum / 400; math.Abs(metrics.MeanNearestNeighbor-want) > 1e-9*want {
+		t.Errorf("random sky: mean nearest neighbor %v, want %v", metrics.MeanNearestNeighbor, want)
+	}
+}
+
+// TestSkyCentroid checks that the centroid of a flock straddling the edge of a wrapping sky lies on the edge
+func TestSkyCentroid(t *testing.T) {
+	sky := Sky{width: 100, height: 50}
+	sky.boids = []Boid{{position: OrderedPair{x: 98, y: 49}}, {position: OrderedPair{x: 4, y: 3}}}
+
+	centroid := SkyCentroid(sky)
+	if math.Abs(centroid.x-1) > 1e-9 || math.Abs(centroid.y-1) > 1e-9 {
+		t.Errorf("SkyCentroid = %v, want (1, 1)", centroid)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+var boundaryNames = []string{
+	WrapBoundary:     "wrap",
+	ReflectBoundary:  "reflect",
+	SoftWallBoundary: "soft",
+	OpenBoundary:     "open",
+}
+
+// String returns the name of the boundary mode used in flags and run files
+func (mode BoundaryMode) String() string {
+	if mode < 0 || int(mode) >= len(boundaryNames) {
+		return fmt.Sprintf("BoundaryMode(%d)", int(mode))
+	}
+	return boundaryNames[mode]
+}
+
+// MarshalText writes the boundary mode by name, so that run files read "boundary": "reflect"
+func (mode BoundaryMode) MarshalText() ([]byte, error) {
+	return []byte(mode.String()), nil
+}
+
+// UnmarshalText reads a boundary mode by name
+func (mode *BoundaryMode) UnmarshalText(text []byte) error {
+	for m, name := range boundaryNames {
+		if string(text) == name {
+			*mode = BoundaryMode(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown boundary %q (want wrap, reflect, soft or open)", text)
+}
+
+// ApplyBoundary returns boid b after the edges of current_sky have acted on its new position.
+// Wrapping moves it to the opposite edge and reflecting mirrors it back in and reverses its velocity;
+// soft walls and the open sky leave it where it is.
+func ApplyBoundary(b Boid, current_sky Sky) Boid {
+	switch current_sky.boundary {
+	case WrapBoundary:
+		b.position.x = WrapCoordinate(b.position.x, current_sky.width)
+		b.position.y = WrapCoordinate(b.position.y, current_sky.height)
+	case ReflectBoundary:
+		b.position.x, b.velocity.x = ReflectCoordinate(b.position.x, b.velocity.x, current_sky.width)
+		b.position.y, b.velocity.y = ReflectCoordinate(b.position.y, b.velocity.y, current_sky.height)
+	}
+
+	return b
+}
+
+// WrapCoordinate maps a coordinate back into [0, sky_size), however far outside it is
+// (sky_size is the width of the sky for x coordinates and its height for y coordinates).
+// A coordinate that is not finite is returned as it is, for CheckFiniteSky to report.
+func WrapCoordinate(x, sky_size float64) float64 {
+	if sky_size <= 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return x
+	}
+
+	wrapped := x - sky_size*math.Floor(x/sky_size)
+	// a coordinate just below 0 rounds up to sky_size itself
+	if wrapped >= sky_size {
+		wrapped = 0
+	}
+	return wrapped
+}
+
+// ReflectCoordinate mirrors a coordinate that crossed 0 or sky_size back into the sky, reversing the velocity component
+// once for every reflection. However far outside the coordinate is, the reflections are folded in closed form;
+// a coordinate that is not finite is returned as it is, for CheckFiniteSky to report.
+func ReflectCoordinate(x, v, sky_size float64) (float64, float64) {
+	if sky_size <= 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return x, v
+	}
+
+	// the first reflection, off 0
+	reflections := 0.0
+	if x < 0 {
+		x = -x
+		reflections = 1
+	}
+
+	// the reflections off sky_size and 0 in turn: the mirrored coordinate repeats every 2*sky_size
+	if x > sky_size {
+		reflections += math.Ceil(x/sky_size) - 1
+		x = math.Mod(x, 2*sky_size)
+		if x > sky_size {
+			x = 2*sky_size - x
+		}
+	}
+
+	if math.Mod(reflections, 2) == 1 {
+		v = -v
+	}
+
+	return x, v
+}
+
+// ComputeWallForce returns the force turning boid b away from the edges of a sky with soft walls.
+// Each wall pushes straight inward with a strength that grows linearly from 0 at wallMargin to wallFactor at the wall,
+// and keeps growing if the boid gets past it.
+func ComputeWallForce(current_sky Sky, b Boid) OrderedPair {
+	var force OrderedPair
+
+	if current_sky.boundary != SoftWallBoundary || current_sky.wallMargin <= 0 {
+		return force
+	}
+
+	margin := current_sky.wallMargin
+	W := current_sky.wallFactor
+
+	force.x += W * math.Max(0, margin-b.position.x) / margin
+	force.x -= W * math.Max(0, margin-(current_sky.width-b.position.x)) / margin
+	force.y += W * math.Max(0, margin-b.position.y) / margin
+	force.y -= W * math.Max(0, margin-(current_sky.height-b.position.y)) / margin
+
+	return force
+}
+
+// MinimumImage returns the position from which a boid at b2_pos acts on a boid at b1_pos:
+// its nearest periodic image on a wrapping sky, and b2_pos itself otherwise
+func MinimumImage(current_sky Sky, b1_pos, b2_pos OrderedPair) OrderedPair {
+	if current_sky.boundary == WrapBoundary {
+		return NearestImage(b1_pos, b2_pos, current_sky.width, current_sky.height)
+	}
+	return b2_pos
+}
+
+// FlockCentroid returns the mean position of the boids
+func FlockCentroid(boids []Boid) OrderedPair {
+	var centroid OrderedPair
+
+	if len(boids) == 0 {
+		return centroid
+	}
+
+	for _, b := range boids {
+		centroid.x += b.position.x
+		centroid.y += b.position.y
+	}
+	centroid.x /= float64(len(boids))
+	centroid.y /= float64(len(boids))
+
+	return centroid
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestApplyBoundary checks where a boid that left a 100 x 100 sky ends up under each boundary mode
+func TestApplyBoundary(t *testing.T) {
+	tests := []struct {
+		boundary BoundaryMode
+		b, want  Boid
+	}{
+		{WrapBoundary, Boid{position: OrderedPair{x: 103, y: -2}}, Boid{position: OrderedPair{x: 3, y: 98}}},
+		{WrapBoundary, Boid{position: OrderedPair{x: 100, y: 50}}, Boid{position: OrderedPair{x: 0, y: 50}}},
+		{ReflectBoundary, Boid{position: OrderedPair{x: 103, y: -2}, velocity: OrderedPair{x: 1, y: -1}},
+			Boid{position: OrderedPair{x: 97, y: 2}, velocity: OrderedPair{x: -1, y: 1}}},
+		{ReflectBoundary, Boid{position: OrderedPair{x: 50, y: 100}, velocity: OrderedPair{x: 1, y: 1}},
+			Boid{position: OrderedPair{x: 50, y: 100}, velocity: OrderedPair{x: 1, y: 1}}},
+		{SoftWallBoundary, Boid{position: OrderedPair{x: 103, y: -2}}, Boid{position: OrderedPair{x: 103, y: -2}}},
+		{OpenBoundary, Boid{position: OrderedPair{x: -500, y: 700}}, Boid{position: OrderedPair{x: -500, y: 700}}},
+	}
+
+	for _, test := range tests {
+		sky := Sky{width: 100, height: 100, boundary: test.boundary}
+		result := ApplyBoundary(test.b, sky)
+
+		epsilon := 1e-9
+		if math.Abs(result.position.x-test.want.position.x) > epsilon || math.Abs(result.position.y-test.want.position.y) > epsilon ||
+			result.velocity != test.want.velocity {
+			t.Errorf("ApplyBoundary(%v, %v) = %v, want %v", test.b, test.boundary, result, test.want)
+		}
+	}
+}
+
+// TestReflectCoordinate checks the folding of coordinates that bounced several times off the edges of a 100 wide sky,
+// including coordinates so far out that the bounces can no longer be counted one by one
+func TestReflectCoordinate(t *testing.T) {
+	tests := []struct {
+		x, want_x, want_v float64
+	}{
+		{103, 97, -1},
+		{-2, 2, -1},
+		{250, 50, 1},
+		{-250, 50, -1},
+		{200, 0, -1},
+		{100, 100, 1},
+	}
+
+	for _, test := range tests {
+		x, v := ReflectCoordinate(test.x, 1, 100)
+		if math.Abs(x-test.want_x) > 1e-9 || v != test.want_v {
+			t.Errorf("ReflectCoordinate(%v) = %v, %v, want %v, %v", test.x, x, v, test.want_x, test.want_v)
+		}
+	}
+
+	for _, far := range []float64{1e300, -1e300} {
+		if x, v := ReflectCoordinate(far, 1, 100); !(x >= 0 && x <= 100) || math.Abs(v) != 1 {
+			t.Errorf("ReflectCoordinate(%v) = %v, %v, want a coordinate in the sky and a reversed or kept velocity", far, x, v)
+		}
+	}
+
+	for _, x := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		if result, v := ReflectCoordinate(x, 1, 100); v != 1 || !(math.IsNaN(result) || math.IsInf(result, 0)) {
+			t.Errorf("ReflectCoordinate(%v) = %v, %v, want it unchanged", x, result, v)
+		}
+	}
+}
+
+// TestWrapCoordinate checks coordinates that left a 100 wide sky by less than its width and by many widths
+func TestWrapCoordinate(t *testing.T) {
+	tests := []struct {
+		x, want float64
+	}{
+		{103, 3},
+		{-2, 98},
+		{100, 0},
+		{-250, 50},
+		{750, 50},
+		{-1e-18, 0},
+	}
+
+	for _, test := range tests {
+		if x := WrapCoordinate(test.x, 100); math.Abs(x-test.want) > 1e-9 {
+			t.Errorf("WrapCoordinate(%v) = %v, want %v", test.x, x, test.want)
+		}
+	}
+
+	for _, far := range []float64{1e300, -1e300} {
+		if x := WrapCoordinate(far, 100); !(x >= 0 && x < 100) {
+			t.Errorf("WrapCoordinate(%v) = %v, want a coordinate in [0, 100)", far, x)
+		}
+	}
+
+	for _, x := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		if result := WrapCoordinate(x, 100); !(math.IsNaN(result) || math.IsInf(result, 0)) {
+			t.Errorf("WrapCoordinate(%v) = %v, want it unchanged", x, result)
+		}
+	}
+}
+
+// TestComputeWallForce checks that soft walls push inward, ramping up linearly within the margin
+func TestComputeWallForce(t *testing.T) {
+	sky := Sky{width: 100, height: 100, boundary: SoftWallBoundary, wallMargin: 10, wallFactor: 2}
+
+	tests := []struct {
+		pos, want OrderedPair
+	}{
+		{OrderedPair{x: 50, y: 50}, OrderedPair{x: 0, y: 0}},
+		{OrderedPair{x: 5, y: 50}, OrderedPair{x: 1, y: 0}},
+		{OrderedPair{x: 50, y: 98}, OrderedPair{x: 0, y: -1.6}},
+		{OrderedPair{x: 0, y: 100}, OrderedPair{x: 2, y: -2}},
+		{OrderedPair{x: -10, y: 50}, OrderedPair{x: 4, y: 0}},
+	}
+
+	for _, test := range tests {
+		result := ComputeWallForce(sky, Boid{position: test.pos})
+
+		epsilon := 1e-9
+		if math.Abs(result.x-test.want.x) > epsilon || math.Abs(result.y-test.want.y) > epsilon {
+			t.Errorf("ComputeWallForce(%v) = %v, want %v", test.pos, result, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Checkpoint records everything needed to continue an interrupted run: the run parameters, the sky of the
+// last completed generation, the state of the random generator, and how far each output file had been written.
+// Continuing from a checkpoint produces the same skies and output files as a run that was never interrupted.
+type Checkpoint struct {
+	Parameters Parameters       `json:"parameters"`
+	OutputFile string           `json:"outputFile"`
+	Generation int              `json:"generation"`
+	RandDraws  uint64           `json:"randDraws"`
+	Sky        SkySnapshot      `json:"sky"`
+	Outputs    map[string]int64 `json:"outputs"` // size in bytes of every output file
+}
+
+// CheckpointFile returns the name of the checkpoint written for the output file prefix output_file
+func CheckpointFile(output_file string) string {
+	return output_file + ".checkpoint.json"
+}
+
+// MakeCheckpoint returns the checkpoint of a run that has completed generation gen with current_sky
+func MakeCheckpoint(params Parameters, output_file string, gen int, current_sky Sky, outputs map[string]int64) Checkpoint {
+	checkpoint := Checkpoint{
+		Parameters: params,
+		OutputFile: output_file,
+		Generation: gen,
+		Sky:        MakeSkySnapshot(current_sky),
+		Outputs:    outputs,
+	}
+
+	if current_sky.rng != nil {
+		_, checkpoint.RandDraws = RandState(current_sky.rng)
+	}
+
+	return checkpoint
+}
+
+// SkyFromCheckpoint returns the sky stored in checkpoint, with its random generator restored
+func SkyFromCheckpoint(checkpoint Checkpoint) Sky {
+	current_sky := SkyFromSnapshot(checkpoint.Sky)
+	current_sky.rng = RestoreSeededRand(checkpoint.Parameters.Seed, checkpoint.RandDraws)
+	return current_sky
+}
+
+// SaveCheckpoint writes checkpoint to filename. The file is replaced in one step,
+// so a run killed while writing leaves the previous checkpoint intact.
+func SaveCheckpoint(filename string, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	temp_file := filename + ".tmp"
+	if err := os.WriteFile(temp_file, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp_file, filename)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint
+func LoadCheckpoint(filename string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return checkpoint, err
+	}
+
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("reading checkpoint %s: %w", filename, err)
+	}
+
+	return checkpoint, nil
+}
+
+// ReopenFile opens an output file of an interrupted run for writing, discarding everything after its first size bytes
+// (the size recorded in the checkpoint), so that writing continues exactly where the checkpoint left off.
+func ReopenFile(filename string, size int64) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestResumeFromCheckpoint interrupts a run at generation 40, resumes it up to generation 60,
+// and checks that the GIF, the trajectories, the metrics, the flocks and the final sky are the same as those of an uninterrupted run
+func TestResumeFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	params := DefaultParameters()
+	params.NumBoids, params.SkyWidth, params.Proximity = 40, 500, 80
+	params.CanvasWidth, params.ImageFrequency = 60, 5
+	params.NumGens, params.CheckpointFrequency, params.Seed = 60, 10, 11
+	params.Trajectory, params.TrajectoryFrequency = "csv,ndjson,columnar", 3
+	params.FlocksFrequency = 2
+	params.NumPredators, params.CatchRadius = 2, 20
+
+	full_output := filepath.Join(dir, "full")
+	initial_sky, err := InitialSky(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RunSimulation(params, full_output, initial_sky, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted_output := filepath.Join(dir, "interrupted")
+	interrupted_params := params
+	interrupted_params.NumGens = 40
+	initial_sky, _ = InitialSky(params)
+	if err := RunSimulation(interrupted_params, interrupted_output, initial_sky, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := LoadCheckpoint(CheckpointFile(interrupted_output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Generation != 40 {
+		t.Fatalf("checkpoint of generation %d, want 40", checkpoint.Generation)
+	}
+	checkpoint.Parameters.NumGens = 60
+	if err := RunSimulation(checkpoint.Parameters, interrupted_output, SkyFromCheckpoint(checkpoint), &checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	full_gif, _ := os.ReadFile(full_output + ".out.gif")
+	resumed_gif, _ := os.ReadFile(interrupted_output + ".out.gif")
+	if len(full_gif) == 0 || !bytes.Equal(full_gif, resumed_gif) {
+		t.Errorf("resumed GIF (%d bytes) differs from uninterrupted GIF (%d bytes)", len(resumed_gif), len(full_gif))
+	}
+
+	series_files := []func(output_file string) string{MetricsFile, FlocksFile}
+	for _, format := range TrajectoryFormats {
+		series_files = append(series_files, func(output_file string) string { return TrajectoryFile(output_file, format) })
+	}
+	for _, series_file := range series_files {
+		full_series, _ := os.ReadFile(series_file(full_output))
+		resumed_series, _ := os.ReadFile(series_file(interrupted_output))
+		if len(full_series) == 0 || !bytes.Equal(full_series, resumed_series) {
+			t.Errorf("resumed %s (%d bytes) differs from uninterrupted file (%d bytes)",
+				filepath.Base(series_file(interrupted_output)), len(resumed_series), len(full_series))
+		}
+	}
+
+	full_checkpoint, _ := LoadCheckpoint(CheckpointFile(full_output))
+	resumed_checkpoint, _ := LoadCheckpoint(CheckpointFile(interrupted_output))
+	if !reflect.DeepEqual(full_checkpoint.Sky, resumed_checkpoint.Sky) {
+		t.Errorf("resumed sky at generation %d differs from uninterrupted sky at generation %d",
+			resumed_checkpoint.Generation, full_checkpoint.Generation)
+	}
+}
+
+// TestRestoreSeededRand checks that a restored generator continues with the values the original would have drawn
+func TestRestoreSeededRand(t *testing.T) {
+	rng := NewSeededRand(99)
+	for i := 0; i < 37; i++ {
+		rng.Float64()
+		rng.Intn(10)
+	}
+
+	restored := RestoreSeededRand(RandState(rng))
+	for i := 0; i < 10; i++ {
+		if want, result := rng.Float64(), restored.Float64(); result != want {
+			t.Fatalf("restored generator drew %v, want %v", result, want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameters contains every setting of a single run: the Sky parameters used to generate
+// the initial sky, the length of the simulation, and the drawing Config.
+// The JSON keys match the command-line flag names so that a run file and a command line read the same.
+type Parameters struct {
+	NumBoids            int                 `json:"numBoids"`
+	SkyWidth            float64             `json:"skyWidth"`
+	SkyHeight           float64             `json:"skyHeight"`
+	InitialSpeed        float64             `json:"initialSpeed"`
+	MaxBoidSpeed        float64             `json:"maxBoidSpeed"`
+	NumGens             int                 `json:"numGens"`
+	Proximity           float64             `json:"proximity"`
+	SeparationFactor    float64             `json:"separationFactor"`
+	AlignmentFactor     float64             `json:"alignmentFactor"`
+	CohesionFactor      float64             `json:"cohesionFactor"`
+	TimeStep            float64             `json:"timeStep"`
+	CanvasWidth         int                 `json:"canvasWidth"`
+	CanvasHeight        int                 `json:"canvasHeight"`
+	ImageFrequency      int                 `json:"imageFrequency"`
+	BoidSize            float64             `json:"boidSize"`
+	BoidColor           Color               `json:"boidColor"`
+	BackgroundColor     Color               `json:"backgroundColor"`
+	Seed                int64               `json:"seed"`
+	Parallel            bool                `json:"parallel"`
+	Boundary            BoundaryMode        `json:"boundary"`
+	WallMargin          float64             `json:"wallMargin"`
+	WallFactor          float64             `json:"wallFactor"`
+	InitialSkyFile      string              `json:"initialSky"`
+	SnapshotFrequency   int                 `json:"snapshotFrequency"`
+	SnapshotFormat      string              `json:"snapshotFormat"`
+	CheckpointFrequency int                 `json:"checkpointFrequency"`
+	Trajectory          string              `json:"trajectory"`
+	TrajectoryFrequency int                 `json:"trajectoryFrequency"`
+	MetricsFrequency    int                 `json:"metricsFrequency"`
+	FlocksFrequency     int                 `json:"flocksFrequency"`
+	Track               []int               `json:"track"`
+	TrackColor          Color               `json:"trackColor"`
+	Scene               string              `json:"scene"`
+	AvoidanceFactor     float64             `json:"avoidanceFactor"`
+	AvoidanceDistance   float64             `json:"avoidanceDistance"`
+	ObstacleColor       Color               `json:"obstacleColor"`
+	NeighborMode        NeighborMode        `json:"neighborMode"`
+	NumNeighbors        int                 `json:"numNeighbors"`
+	VisionAngle         float64             `json:"visionAngle"`
+	SeparationAngle     float64             `json:"separationAngle"`
+	AlignmentAngle      float64             `json:"alignmentAngle"`
+	CohesionAngle       float64             `json:"cohesionAngle"`
+	BlindSpot           float64             `json:"blindSpot"`
+	Rules               []RuleSetting       `json:"rules,omitempty"`
+	Model               ForceModel          `json:"model"`
+	MaxForce            float64             `json:"maxForce"`
+	Noise               float64             `json:"noise"`
+	Integrator          IntegrationScheme   `json:"integrator"`
+	Species             []SpeciesParameters `json:"species,omitempty"`
+	NumPredators        int                 `json:"numPredators"`
+	MaxPredatorSpeed    float64             `json:"maxPredatorSpeed"`
+	PursuitFactor       float64             `json:"pursuitFactor"`
+	FearRadius          float64             `json:"fearRadius"`
+	FleeFactor          float64             `json:"fleeFactor"`
+	CatchRadius         float64             `json:"catchRadius"`
+	PredatorColor       Color               `json:"predatorColor"`
+	Output              string              `json:"output"`
+	Timestamp           bool                `json:"timestamp"`
+}
+
+// DefaultParameters returns the parameters used when neither a run file nor a flag sets a value.
+func DefaultParameters() Parameters {
+	return Parameters{
+		NumBoids:            200,
+		SkyWidth:            2000.0,
+		InitialSpeed:        1.0,
+		MaxBoidSpeed:        2.0,
+		NumGens:             8000,
+		Proximity:           200.0,
+		SeparationFactor:    1.5,
+		AlignmentFactor:     1.0,
+		CohesionFactor:      0.02,
+		TimeStep:            1.0,
+		CanvasWidth:         2000,
+		ImageFrequency:      100,
+		BoidSize:            5.0,
+		BoidColor:           Color{R: 255, G: 255, B: 255, A: 255},
+		BackgroundColor:     Color{R: 173, G: 216, B: 230}, // Light blue background
+		Boundary:            WrapBoundary,
+		WallMargin:          100.0,
+		WallFactor:          1.0,
+		SnapshotFormat:      "json",
+		TrajectoryFrequency: 1,
+		MetricsFrequency:    1,
+		TrackColor:          Color{R: 255, G: 0, B: 0, A: 255},
+		AvoidanceFactor:     2.0,
+		AvoidanceDistance:   50.0,
+		ObstacleColor:       Color{R: 90, G: 90, B: 90, A: 255},
+		NumNeighbors:        7,
+		VisionAngle:         360.0,
+		MaxForce:            0.1,
+		Noise:               0.5,
+		MaxPredatorSpeed:    3.0,
+		PursuitFactor:       0.5,
+		FearRadius:          250.0,
+		FleeFactor:          2.0,
+		PredatorColor:       Color{R: 255, G: 140, B: 0, A: 255},
+		Output:              "output/test_boids",
+	}
+}
+
+// ParseParameters reads the run parameters from the command-line arguments (without the program name).
+// If -config names a JSON run file, the file is applied on top of the defaults,
+// and every flag given explicitly on the command line overrides the value from the file.
+// The parameters are validated, so an error lists every parameter that cannot be simulated.
+func ParseParameters(args []string) (Parameters, error) {
+	params := DefaultParameters()
+	if err := ParseParameterFlags(NewParameterFlagSet(&params), &params, args); err != nil {
+		return params, err
+	}
+	return params, ValidateParameters(params)
+}
+
+// ParseParameterFlags parses args with fs, a flag set from NewParameterFlagSet(params) to which
+// a subcommand may have added flags of its own, and applies the -config run file as ParseParameters does.
+// The arguments are parsed a second time after loading a run file, so the added flags must tolerate being set twice.
+func ParseParameterFlags(fs *flag.FlagSet, params *Parameters, args []string) error {
+	var config_file string
+	fs.StringVar(&config_file, "config", "", "JSON run file setting any of the parameters below (flags override the file)")
+
+	if err := fs.Parse(args); err != nil {
+		return UsageError(err)
+	}
+
+	if config_file != "" {
+		if err := LoadParameters(config_file, params); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidParameters, err)
+		}
+		// parse a second time so that the flags take precedence over the run file
+		if err := fs.Parse(args); err != nil {
+			return UsageError(err)
+		}
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %q (all parameters are named flags, see -help)", ErrInvalidParameters, fs.Args())
+	}
+
+	return nil
+}
+
+// NewParameterFlagSet returns a flag set with one flag per field of params.
+// Parsing the flag set writes the values directly into params.
+func NewParameterFlagSet(params *Parameters) *flag.FlagSet {
+	fs := flag.NewFlagSet("boids", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: boids [flags]")
+		fmt.Fprintln(fs.Output(), "       boids resume [-checkpoint file] [-numGens n]")
+		fmt.Fprintln(fs.Output(), "       boids sweep -vary name=from:to:n|v1,v2,... [-vary ...] [sweep flags] [flags]")
+		fs.PrintDefaults()
+	}
+
+	fs.IntVar(&params.NumBoids, "numBoids", params.NumBoids, "number of boids in the initial sky")
+	fs.Float64Var(&params.SkyWidth, "skyWidth", params.SkyWidth, "width of the sky")
+	fs.Float64Var(&params.SkyHeight, "skyHeight", params.SkyHeight, "height of the sky (0 makes it as high as it is wide)")
+	fs.Float64Var(&params.InitialSpeed, "initialSpeed", params.InitialSpeed, "initial speed of every boid")
+	fs.Float64Var(&params.MaxBoidSpeed, "maxBoidSpeed", params.MaxBoidSpeed, "fastest speed that a boid can fly")
+	fs.IntVar(&params.NumGens, "numGens", params.NumGens, "number of generations to simulate")
+	fs.Float64Var(&params.Proximity, "proximity", params.Proximity, "distance within which boids exert forces on each other")
+	fs.Float64Var(&params.SeparationFactor, "separationFactor", params.SeparationFactor, "multiplier of the separation force")
+	fs.Float64Var(&params.AlignmentFactor, "alignmentFactor", params.AlignmentFactor, "multiplier of the alignment force")
+	fs.Float64Var(&params.CohesionFactor, "cohesionFactor", params.CohesionFactor, "multiplier of the cohesion force")
+	fs.Float64Var(&params.TimeStep, "timeStep", params.TimeStep, "time elapsed between two generations")
+	fs.IntVar(&params.CanvasWidth, "canvasWidth", params.CanvasWidth, "width of the drawn images in pixels")
+	fs.IntVar(&params.CanvasHeight, "canvasHeight", params.CanvasHeight, "height of the drawn images in pixels (0 keeps the aspect ratio of the sky)")
+	fs.IntVar(&params.ImageFrequency, "imageFrequency", params.ImageFrequency, "draw every imageFrequency-th generation")
+	fs.Float64Var(&params.BoidSize, "boidSize", params.BoidSize, "size of a drawn boid: its triangle reaches 16*boidSize ahead and 6*boidSize to the sides, in sky units")
+	fs.Int64Var(&params.Seed, "seed", params.Seed, "random seed of the simulation (0 picks a seed from the clock)")
+	fs.BoolVar(&params.Parallel, "parallel", params.Parallel, "update the boids of each generation on GOMAXPROCS goroutines (same results as serial)")
+	fs.TextVar(&params.Boundary, "boundary", params.Boundary, "edges of the sky: wrap, reflect, soft (walls within wallMargin) or open")
+	fs.Float64Var(&params.WallMargin, "wallMargin", params.WallMargin, "soft walls: distance from an edge at which boids start turning away")
+	fs.Float64Var(&params.WallFactor, "wallFactor", params.WallFactor, "soft walls: strength of the push away from an edge")
+	fs.StringVar(&params.InitialSkyFile, "initialSky", params.InitialSkyFile, "start from a sky saved as a JSON or binary snapshot instead of a random sky")
+	fs.IntVar(&params.SnapshotFrequency, "snapshotFrequency", params.SnapshotFrequency, "save every snapshotFrequency-th sky as a snapshot (0 saves none)")
+	fs.StringVar(&params.SnapshotFormat, "snapshotFormat", params.SnapshotFormat, "format of the saved snapshots: json or binary")
+	fs.IntVar(&params.CheckpointFrequency, "checkpointFrequency", params.CheckpointFrequency, "checkpoint the run every checkpointFrequency generations, for \"boids resume\" (0 never checkpoints)")
+	fs.StringVar(&params.Trajectory, "trajectory", params.Trajectory, "export the trajectory of every boid as a comma-separated list of formats: csv, ndjson, columnar (empty exports none)")
+	fs.IntVar(&params.TrajectoryFrequency, "trajectoryFrequency", params.TrajectoryFrequency, "export every trajectoryFrequency-th generation to the trajectory files")
+	fs.IntVar(&params.MetricsFrequency, "metricsFrequency", params.MetricsFrequency, "record the flock metrics of every metricsFrequency-th generation (0 records none)")
+	fs.IntVar(&params.FlocksFrequency, "flocksFrequency", params.FlocksFrequency, "record every flock of every flocksFrequency-th generation (0 records none)")
+	fs.StringVar(&params.Scene, "scene", params.Scene, "JSON scene file with circular and polygonal obstacles")
+	fs.Float64Var(&params.AvoidanceFactor, "avoidanceFactor", params.AvoidanceFactor, "obstacles: strength of the push away from an obstacle's surface")
+	fs.Float64Var(&params.AvoidanceDistance, "avoidanceDistance", params.AvoidanceDistance, "obstacles: distance from an obstacle at which boids start turning away")
+	fs.Func("obstacleColor", "color of the obstacles as R,G,B[,A] (default \""+FormatColor(params.ObstacleColor)+"\")", func(s string) error {
+		return ParseColor(s, &params.ObstacleColor)
+	})
+	fs.TextVar(&params.NeighborMode, "neighborMode", params.NeighborMode, "neighbors of a boid: metric (every boid within proximity) or topological (the numNeighbors nearest)")
+	fs.IntVar(&params.NumNeighbors, "numNeighbors", params.NumNeighbors, "topological neighbors: number of nearest boids each boid interacts with")
+	fs.Float64Var(&params.VisionAngle, "visionAngle", params.VisionAngle, "vision: width in degrees of the cone around its heading in which a boid sees its neighbors (360 or 0 sees all around)")
+	fs.Float64Var(&params.SeparationAngle, "separationAngle", params.SeparationAngle, "vision: width of the cone for separation only (0 uses visionAngle)")
+	fs.Float64Var(&params.AlignmentAngle, "alignmentAngle", params.AlignmentAngle, "vision: width of the cone for alignment only (0 uses visionAngle)")
+	fs.Float64Var(&params.CohesionAngle, "cohesionAngle", params.CohesionAngle, "vision: width of the cone for cohesion only (0 uses visionAngle)")
+	fs.Float64Var(&params.BlindSpot, "blindSpot", params.BlindSpot, "vision: width in degrees of the cone behind a boid in which it sees nothing")
+	fs.Func("rules", "enabled steering rules as name[:weight],... out of "+strings.Join(RuleNames(), ", ")+" (default \""+FormatRules(DefaultRules())+"\")", func(s string) error {
+		rules, err := ParseRules(s)
+		if err != nil {
+			return err
+		}
+		params.Rules = rules
+		return nil
+	})
+	fs.TextVar(&params.Model, "model", params.Model, "force model: classic (1/d² separation, velocity/d alignment, displacement/d cohesion), reynolds (steering toward a desired velocity) or vicsek (constant speed, noisy mean heading)")
+	fs.Float64Var(&params.MaxForce, "maxForce", params.MaxForce, "reynolds model: largest steering force of one rule")
+	fs.Float64Var(&params.Noise, "noise", params.Noise, "vicsek model: width in radians (0 to 2π) of the random turn of each boid at every step")
+	fs.TextVar(&params.Integrator, "integrator", params.Integrator, "numerical integrator of the boids: legacy, euler, semi-implicit, verlet or rk4")
+	fs.IntVar(&params.NumPredators, "numPredators", params.NumPredators, "number of predators hunting the boids")
+	fs.Float64Var(&params.MaxPredatorSpeed, "maxPredatorSpeed", params.MaxPredatorSpeed, "predators: maximum speed of a predator")
+	fs.Float64Var(&params.PursuitFactor, "pursuitFactor", params.PursuitFactor, "predators: strength of the pull of a predator toward the nearest boid")
+	fs.Float64Var(&params.FearRadius, "fearRadius", params.FearRadius, "predators: distance at which boids start fleeing a predator")
+	fs.Float64Var(&params.FleeFactor, "fleeFactor", params.FleeFactor, "predators: strength of the flight of a boid from a predator")
+	fs.Float64Var(&params.CatchRadius, "catchRadius", params.CatchRadius, "predators: a boid closer than this to a predator is caught and removed (0 never catches)")
+	fs.Func("predatorColor", "color of the predators as R,G,B[,A] (default \""+FormatColor(params.PredatorColor)+"\")", func(s string) error {
+		return ParseColor(s, &params.PredatorColor)
+	})
+	fs.StringVar(&params.Output, "output", params.Output, "path prefix of the output files; missing directories are created")
+	fs.BoolVar(&params.Timestamp, "timestamp", params.Timestamp, "put the output files in a new directory named after the output prefix and the start time")
+	fs.Func("track", "ids of boids to highlight in the drawing, as a comma-separated list", func(s string) error {
+		return ParseIDs(s, &params.Track)
+	})
+	fs.Func("trackColor", "color of the highlighted boids as R,G,B[,A] (default \""+FormatColor(params.TrackColor)+"\")", func(s string) error {
+		return ParseColor(s, &params.TrackColor)
+	})
+	fs.Func("boidColor", "color of the boids as R,G,B[,A] (default \""+FormatColor(params.BoidColor)+"\")", func(s string) error {
+		return ParseColor(s, &params.BoidColor)
+	})
+	fs.Func("backgroundColor", "background color as R,G,B[,A] (default \""+FormatColor(params.BackgroundColor)+"\")", func(s string) error {
+		return ParseColor(s, &params.BackgroundColor)
+	})
+
+	return fs
+}
+
+// LoadParameters reads a JSON run file into params. Keys missing from the file leave params unchanged,
+// and unknown keys are rejected so that a misspelled parameter is not silently ignored.
+func LoadParameters(filename string, params *Parameters) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(params); err != nil {
+		return fmt.Errorf("reading run file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// SaveParameters writes params as a JSON run file that LoadParameters can read back,
+// so that the run can be repeated with -config.
+func SaveParameters(filename string, params Parameters) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// OutputFile returns the path prefix of the output files of a run started at start.
+// With params.Timestamp the files of each run go into their own directory, next to where params.Output points:
+// output/test_boids becomes output/test_boids-20060102-150405/test_boids.
+func OutputFile(params Parameters, start time.Time) string {
+	if !params.Timestamp {
+		return params.Output
+	}
+
+	dir, name := filepath.Split(params.Output)
+	return filepath.Join(dir, name+"-"+start.Format("20060102-150405"), name)
+}
+
+// ParseColor parses a color written as "R,G,B" or "R,G,B,A" into c.
+func ParseColor(s string, c *Color) error {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 && len(fields) != 4 {
+		return fmt.Errorf("color %q must be R,G,B or R,G,B,A", s)
+	}
+
+	var channels [4]uint8
+	for i, field := range fields {
+		value, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil {
+			return fmt.Errorf("color %q: %w", s, err)
+		}
+		channels[i] = uint8(value)
+	}
+
+	c.R, c.G, c.B, c.A = channels[0], channels[1], channels[2], channels[3]
+
+	return nil
+}
+
+// FormatColor writes a color in the form accepted by ParseColor.
+func FormatColor(c Color) string {
+	return fmt.Sprintf("%d,%d,%d,%d", c.R, c.G, c.B, c.A)
+}
+
+// ParseIDs parses a comma-separated list of boid ids into ids.
+func ParseIDs(s string, ids *[]int) error {
+	*ids = nil
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return fmt.Errorf("boid ids %q: %w", s, err)
+		}
+		*ids = append(*ids, id)
+	}
+
+	return nil
+}
+
+// InitialSky generates the random initial sky described by params, or loads it from params.InitialSkyFile.
+// With species in params, their counts and parameters replace numBoids and the flocking parameters.
+// A loaded sky keeps its own parameters and boids; only its random generator comes from params.Seed,
+// and its obstacles from params.Scene if one is given.
+func InitialSky(params Parameters) (Sky, error) {
+	if params.InitialSkyFile != "" {
+		initial_sky, err := LoadSky(params.InitialSkyFile)
+		if err != nil {
+			return Sky{}, err
+		}
+		initial_sky.rng = NewSeededRand(params.Seed)
+		if err := ValidateSky(initial_sky); err != nil {
+			return Sky{}, fmt.Errorf("sky %s: %w", params.InitialSkyFile, err)
+		}
+		return AddScene(initial_sky, params)
+	}
+
+	sky_height := params.SkyHeight
+	if sky_height == 0 {
+		sky_height = params.SkyWidth
+	}
+
+	var initial_sky Sky
+	if len(params.Species) > 0 {
+		species := make([]Species, len(params.Species))
+		counts := make([]int, len(params.Species))
+		for k, s := range params.Species {
+			species[k], counts[k] = s.Species, s.Count
+		}
+		initial_sky = GenerateRandomSpeciesSky(species, counts, params.SkyWidth, sky_height, params.InitialSpeed, params.Seed)
+	} else {
+		initial_sky = GenerateRandomSky(params.NumBoids, params.SkyWidth, sky_height, params.InitialSpeed, params.MaxBoidSpeed, params.Proximity,
+			params.SeparationFactor, params.AlignmentFactor, params.CohesionFactor, params.Seed)
+	}
+
+	initial_sky.boundary = params.Boundary
+	initial_sky.neighborMode = params.NeighborMode
+	initial_sky.numNeighbors = params.NumNeighbors
+	initial_sky.vision = MakeVision(params)
+	initial_sky.rules = params.Rules
+	initial_sky.model = params.Model
+	initial_sky.maxForce = params.MaxForce
+	initial_sky.noise = params.Noise
+	initial_sky.integrator = params.Integrator
+	initial_sky.wallMargin = params.WallMargin
+	initial_sky.wallFactor = params.WallFactor
+	initial_sky.avoidanceFactor = params.AvoidanceFactor
+	initial_sky.avoidanceDistance = params.AvoidanceDistance
+	initial_sky.maxPredatorSpeed = params.MaxPredatorSpeed
+	initial_sky.pursuitFactor = params.PursuitFactor
+	initial_sky.fearRadius = params.FearRadius
+	initial_sky.fleeFactor = params.FleeFactor
+	initial_sky.catchRadius = params.CatchRadius
+	initial_sky = AddPredators(initial_sky, params.NumPredators, params.InitialSpeed)
+
+	return AddScene(initial_sky, params)
+}
+
+// AddScene places the obstacles of params.Scene in initial_sky, replacing any it already has,
+// and moves boids that start inside an obstacle out of it
+func AddScene(initial_sky Sky, params Parameters) (Sky, error) {
+	if params.Scene == "" {
+		return initial_sky, nil
+	}
+
+	obstacles, err := LoadScene(params.Scene)
+	if err != nil {
+		return Sky{}, err
+	}
+
+	initial_sky.obstacles = obstacles
+	initial_sky.avoidanceFactor = params.AvoidanceFactor
+	initial_sky.avoidanceDistance = params.AvoidanceDistance
+	for i := range initial_sky.boids {
+		initial_sky.boids[i] = ResolveObstacles(initial_sky.boids[i], initial_sky)
+	}
+
+	return initial_sky, nil
+}
+
+// SnapshotFile returns the name of the snapshot of generation gen written for the output file prefix output_file
+func SnapshotFile(output_file string, gen int, format string) string {
+	if format == "binary" {
+		return fmt.Sprintf("%s.gen%06d.sky", output_file, gen)
+	}
+	return fmt.Sprintf("%s.gen%06d.json", output_file, gen)
+}
+
+// MakeVision returns the vision cones described by params.
+func MakeVision(params Parameters) Vision {
+	return Vision{
+		Angle:           params.VisionAngle,
+		SeparationAngle: params.SeparationAngle,
+		AlignmentAngle:  params.AlignmentAngle,
+		CohesionAngle:   params.CohesionAngle,
+		BlindSpot:       params.BlindSpot,
+	}
+}
+
+// MakeConfig returns the drawing Config described by params.
+func MakeConfig(params Parameters) Config {
+	return Config{
+		CanvasWidth:     params.CanvasWidth,
+		CanvasHeight:    params.CanvasHeight,
+		BoidSize:        params.BoidSize,
+		BoidColor:       params.BoidColor,
+		BackgroundColor: params.BackgroundColor,
+		Track:           params.Track,
+		TrackColor:      params.TrackColor,
+		ObstacleColor:   params.ObstacleColor,
+		PredatorColor:   params.PredatorColor,
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseParameters checks that the run file is applied on top of the defaults
+// and that explicit flags override the run file.
+func TestParseParameters(t *testing.T) {
+	run_file := filepath.Join(t.TempDir(), "run.json")
+	content := `{"numBoids": 50, "proximity": 120, "cohesionFactor": 0.5, "boidColor": {"R": 1, "G": 2, "B": 3, "A": 4}}`
+	if err := os.WriteFile(run_file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := ParseParameters([]string{"-numBoids", "75", "-config", run_file, "-backgroundColor", "9,8,7", "-track", "4,11"})
+	if err != nil {
+		t.Fatalf("ParseParameters returned error: %v", err)
+	}
+
+	want := DefaultParameters()
+	want.NumBoids = 75 // flag overrides the file
+	want.Proximity = 120
+	want.CohesionFactor = 0.5
+	want.BoidColor = Color{R: 1, G: 2, B: 3, A: 4}
+	want.BackgroundColor = Color{R: 9, G: 8, B: 7}
+	want.Track = []int{4, 11}
+
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("ParseParameters = %+v, want %+v", params, want)
+	}
+}
+
+// TestParseParametersErrors checks that misspelled keys and stray positional arguments are rejected.
+func TestParseParametersErrors(t *testing.T) {
+	run_file := filepath.Join(t.TempDir(), "run.json")
+	if err := os.WriteFile(run_file, []byte(`{"numBoid": 50}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseParameters([]string{"-config", run_file}); err == nil {
+		t.Errorf("ParseParameters accepted unknown key in run file")
+	}
+
+	if _, err := ParseParameters([]string{"200", "2000"}); err == nil {
+		t.Errorf("ParseParameters accepted positional arguments")
+	}
+}
@@ -8,17 +8,81 @@ type OrderedPair struct {
 
 // Boid represents our "bird" object. It contains two
 // OrderedPair fields: its position, velocity, and acceleration.
+// Its id stays the same in every generation, so that a bird can be followed from frame to frame.
+// Its species is an index into the species of its sky (0 when the sky has a single species).
 type Boid struct {
+	id, species                      int
 	position, velocity, acceleration OrderedPair
 }
 
 // Sky represents a single time point of the simulation.
-// It contains a width parameter indicating the boundary of the sky, and a slice of Boid objects.
+// It contains width and height parameters indicating the boundary of the sky, and a slice of Boid objects.
 // It also contains the system parameters (proximity, separationFactor, alignmentFactor, cohesionFactor, maxBoidSpeed)
+// and the random generator of the simulation it belongs to.
+// If the sky has species, each boid follows the parameters of its species instead,
+// and proximity and maxBoidSpeed are the largest over the species.
 type Sky struct {
-	width                                             float64
+	width, height                                     float64
 	boids                                             []Boid
-	proximity                                         float64 // used to determine if boids are close enough for forces to apply
-	separationFactor, alignmentFactor, cohesionFactor float64 // multiply by each respective force
-	maxBoidSpeed                                      float64 // fastest speed that a boid can fly
+	proximity                                         float64           // used to determine if boids are close enough for forces to apply
+	separationFactor, alignmentFactor, cohesionFactor float64           // multiply by each respective force
+	maxBoidSpeed                                      float64           // fastest speed that a boid can fly
+	boundary                                          BoundaryMode      // what happens to boids at the edges of the sky
+	wallMargin, wallFactor                            float64           // soft walls: distance at which boids start turning away, and strength of the turn
+	neighborMode                                      NeighborMode      // metric (within proximity) or topological (k nearest) neighborhoods
+	numNeighbors                                      int               // k of the topological mode
+	vision                                            Vision            // vision cones limiting which neighbors each rule reacts to
+	rules                                             []RuleSetting     // enabled steering rules and their weights; nil follows DefaultRules
+	model                                             ForceModel        // form of the classic rules: classic forces, Reynolds steering or Vicsek headings
+	maxForce                                          float64           // Reynolds model: largest steering force of one rule
+	noise                                             float64           // Vicsek model: width in radians of the random turn of each step
+	integrator                                        IntegrationScheme // numerical scheme moving the boids by one time step
+	species                                           []Species         // kinds of boids with their own parameters and colors; nil for a single species
+	obstacles                                         []Obstacle        // static circles and polygons the boids steer around
+	avoidanceFactor, avoidanceDistance                float64           // strength of the push away from an obstacle, and distance from its surface at which it starts
+	predators                                         []Boid            // agents hunting the boids, numbered apart from the boids
+	maxPredatorSpeed, pursuitFactor                   float64           // fastest speed of a predator, and strength of its pull toward the nearest boid
+	fearRadius, fleeFactor                            float64           // distance at which boids start fleeing a predator, and strength of the flight
+	catchRadius                                       float64           // a boid closer than this to a predator is caught; 0 means predators never catch
+	captures                                          int               // number of boids caught so far
+	rng                                               *SeededRand       // seeded generator shared by every generation of one simulation
+	grid                                              *SpatialGrid      // index of the boid positions, built by UpdateSky; nil means brute-force neighbor search
 }
+
+// BoundaryMode selects how the edges of the sky act on the boids.
+type BoundaryMode int
+
+const (
+	WrapBoundary     BoundaryMode = iota // periodic sky: a boid leaving one edge re-enters at the opposite edge
+	ReflectBoundary                      // boids bounce elastically off the edges
+	SoftWallBoundary                     // boids steer away from the edges once they come within wallMargin
+	OpenBoundary                         // unbounded sky, the drawing follows the flock
+)
+
+// NeighborMode selects which boids a boid interacts with.
+type NeighborMode int
+
+const (
+	MetricNeighbors      NeighborMode = iota // every boid closer than proximity
+	TopologicalNeighbors                     // the numNeighbors nearest boids, however far they are
+)
+
+// ForceModel selects the law by which neighbors steer a boid.
+type ForceModel int
+
+const (
+	ClassicModel  ForceModel = iota // separation 1/d², alignment velocity/d and cohesion displacement/d forces
+	ReynoldsModel                   // Reynolds' steering toward a desired velocity, clamped to maxForce
+	VicsekModel                     // constant speed, heading set to the noisy mean heading of the neighbors
+)
+
+// IntegrationScheme selects the Integrator that moves the boids by one time step.
+type IntegrationScheme int
+
+const (
+	LegacyScheme       IntegrationScheme = iota // the original scheme of UpdateVelocity and UpdatePosition
+	EulerScheme                                 // explicit Euler
+	SemiImplicitScheme                          // semi-implicit (symplectic) Euler
+	VerletScheme                                // velocity Verlet
+	RK4Scheme                                   // fourth-order Runge-Kutta
+)
@@ -9,9 +9,14 @@ import (
 // Config contains customizable parameters for the animation
 type Config struct {
 	CanvasWidth     int
+	CanvasHeight    int // 0 keeps the aspect ratio of the sky
 	BoidSize        float64
 	BoidColor       Color
 	BackgroundColor Color
+	Track           []int // ids of the boids drawn in TrackColor, to follow them from frame to frame
+	TrackColor      Color
+	ObstacleColor   Color
+	PredatorColor   Color
 }
 
 // Color represents an RGB color with an optional alpha component
@@ -34,59 +39,149 @@ func AnimateSystem(timePoints []Sky, config Config, drawingFrequency int) []imag
 	return images
 }
 
+// DrawToCanvas draws the boids of currentSky on a new canvas and returns the image.
 func DrawToCanvas(currentSky Sky, config Config) image.Image {
-	c := canvas.CreateNewCanvas(config.CanvasWidth, config.CanvasWidth)
+	config.CanvasWidth, config.CanvasHeight = CanvasSize(config, currentSky)
+	c := canvas.CreateNewCanvas(config.CanvasWidth, config.CanvasHeight)
 
 	// Set background color
 	c.SetFillColor(canvas.MakeColor(config.BackgroundColor.R, config.BackgroundColor.G, config.BackgroundColor.B))
-	c.ClearRect(0, 0, config.CanvasWidth, config.CanvasWidth)
+	c.ClearRect(0, 0, config.CanvasWidth, config.CanvasHeight)
 	c.Fill()
 
+	// The drawn window is the sky itself, except in an open sky where a window of the same size follows the flock
+	viewOrigin := OrderedPair{}
+	if currentSky.boundary == OpenBoundary && len(currentSky.boids) > 0 {
+		centroid := FlockCentroid(currentSky.boids)
+		viewOrigin = OrderedPair{x: centroid.x - currentSky.width/2, y: centroid.y - currentSky.height/2}
+	}
+
+	// obstacles go under the boids
+	for _, o := range currentSky.obstacles {
+		DrawObstacle(&c, o, config, viewOrigin, currentSky.width, currentSky.height)
+	}
+
+	tracked := make(map[int]bool, len(config.Track))
+	for _, id := range config.Track {
+		tracked[id] = true
+	}
+	trackConfig := config
+	trackConfig.BoidColor = config.TrackColor
+
 	for _, b := range currentSky.boids {
-		// Draw the boid
-		DrawBoid(&c, b, config, currentSky.width)
+		// Draw the boid, in the color of its species if the sky has species
+		b.position.x -= viewOrigin.x
+		b.position.y -= viewOrigin.y
+		if !tracked[b.id] {
+			speciesConfig := config
+			if len(currentSky.species) > 0 {
+				speciesConfig.BoidColor = currentSky.species[b.species].Color
+			}
+			DrawBoid(&c, b, speciesConfig, currentSky.width, currentSky.height, false)
+		}
+	}
+
+	// tracked boids are drawn last so that they stay visible inside a dense flock
+	for _, b := range currentSky.boids {
+		b.position.x -= viewOrigin.x
+		b.position.y -= viewOrigin.y
+		if tracked[b.id] {
+			DrawBoid(&c, b, trackConfig, currentSky.width, currentSky.height, false)
+		}
+	}
+
+	// predators go on top of everything
+	for _, p := range currentSky.predators {
+		p.position.x -= viewOrigin.x
+		p.position.y -= viewOrigin.y
+		DrawBoid(&c, p, config, currentSky.width, currentSky.height, true)
 	}
 
 	return c.GetImage()
 }
 
+// CanvasSize returns the width and height in pixels of the images drawn for currentSky.
+// Without an explicit CanvasHeight the height follows the aspect ratio of the sky.
+func CanvasSize(config Config, currentSky Sky) (int, int) {
+	if config.CanvasHeight > 0 || currentSky.width <= 0 {
+		return config.CanvasWidth, config.CanvasHeight
+	}
+	return config.CanvasWidth, int(math.Round(float64(config.CanvasWidth) * currentSky.height / currentSky.width))
+}
+
 // DrawBoid draws the boid on the canvas
-func DrawBoid(c *canvas.Canvas, b Boid, config Config, skyWidth float64) {
+// A predator is drawn twice as large, in PredatorColor and with a thicker outline
+func DrawBoid(c *canvas.Canvas, b Boid, config Config, skyWidth, skyHeight float64, predator bool) {
 	// Compute triangle points for the boid
-	point1, point2, point3 := ComputeTrianglePoints(b.position, b.velocity)
+	point1, point2, point3 := ComputeTrianglePoints(b.position, b.velocity, config.BoidSize)
+
+	color := config.BoidColor
+	c.SetLineWidth(1)
+	if predator {
+		color = config.PredatorColor
+		c.SetLineWidth(3)
+		for _, point := range []*OrderedPair{&point1, &point2, &point3} {
+			point.x = b.position.x + 2*(point.x-b.position.x)
+			point.y = b.position.y + 2*(point.y-b.position.y)
+		}
+	}
 
 	// Draw the boid's triangle
-	c.SetFillColor(canvas.MakeColor(config.BoidColor.R, config.BoidColor.G, config.BoidColor.B))
-	c.MoveTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point2.x/skyWidth)*float64(config.CanvasWidth), (point2.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point3.x/skyWidth)*float64(config.CanvasWidth), (point3.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyWidth)*float64(config.CanvasWidth))
+	c.SetFillColor(canvas.MakeColor(color.R, color.G, color.B))
+	c.MoveTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point2.x/skyWidth)*float64(config.CanvasWidth), (point2.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point3.x/skyWidth)*float64(config.CanvasWidth), (point3.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyHeight)*float64(config.CanvasHeight))
 	c.Fill()
 
 	// Draw triangle outline
 	c.SetStrokeColor(canvas.MakeColor(0, 0, 0))
-	c.MoveTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point2.x/skyWidth)*float64(config.CanvasWidth), (point2.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point3.x/skyWidth)*float64(config.CanvasWidth), (point3.y/skyWidth)*float64(config.CanvasWidth))
-	c.LineTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyWidth)*float64(config.CanvasWidth))
+	c.MoveTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point2.x/skyWidth)*float64(config.CanvasWidth), (point2.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point3.x/skyWidth)*float64(config.CanvasWidth), (point3.y/skyHeight)*float64(config.CanvasHeight))
+	c.LineTo((point1.x/skyWidth)*float64(config.CanvasWidth), (point1.y/skyHeight)*float64(config.CanvasHeight))
 	c.Stroke()
 }
 
-// ComputeTrianglePoints calculates the three points of a triangle representing a boid
-func ComputeTrianglePoints(position OrderedPair, velocity OrderedPair) (OrderedPair, OrderedPair, OrderedPair) {
+// DrawObstacle draws the obstacle on the canvas, shifted so that viewOrigin is the top left corner of the canvas
+func DrawObstacle(c *canvas.Canvas, o Obstacle, config Config, viewOrigin OrderedPair, skyWidth, skyHeight float64) {
+	scaleX := float64(config.CanvasWidth) / skyWidth
+	scaleY := float64(config.CanvasHeight) / skyHeight
+
+	c.SetFillColor(canvas.MakeColor(config.ObstacleColor.R, config.ObstacleColor.G, config.ObstacleColor.B))
+
+	if o.vertices == nil {
+		c.Circle((o.center.x-viewOrigin.x)*scaleX, (o.center.y-viewOrigin.y)*scaleY, o.radius*scaleX)
+		c.Fill()
+		return
+	}
+
+	c.MoveTo((o.vertices[0].x-viewOrigin.x)*scaleX, (o.vertices[0].y-viewOrigin.y)*scaleY)
+	for _, v := range o.vertices[1:] {
+		c.LineTo((v.x-viewOrigin.x)*scaleX, (v.y-viewOrigin.y)*scaleY)
+	}
+	c.LineTo((o.vertices[0].x-viewOrigin.x)*scaleX, (o.vertices[0].y-viewOrigin.y)*scaleY)
+	c.Fill()
+}
+
+// ComputeTrianglePoints calculates the three points of a triangle representing a boid of the given size:
+// the tip lies 16*size ahead of the boid along its velocity, and the other two corners 6*size from it
+// (a size of 5 draws the original 80 by 30 triangle)
+func ComputeTrianglePoints(position OrderedPair, velocity OrderedPair, size float64) (OrderedPair, OrderedPair, OrderedPair) {
 	direction := math.Atan2(velocity.y, velocity.x)
+	tip, corner := 16*size, 6*size
 
 	point1 := OrderedPair{
-		x: position.x + 80*math.Cos(direction),
-		y: position.y + 80*math.Sin(direction),
+		x: position.x + tip*math.Cos(direction),
+		y: position.y + tip*math.Sin(direction),
 	}
 	point2 := OrderedPair{
-		x: position.x + 30*math.Cos(direction+2*math.Pi/3),
-		y: position.y + 30*math.Sin(direction+2*math.Pi/3),
+		x: position.x + corner*math.Cos(direction+2*math.Pi/3),
+		y: position.y + corner*math.Sin(direction+2*math.Pi/3),
 	}
 	point3 := OrderedPair{
-		x: position.x + 30*math.Cos(direction+4*math.Pi/3),
-		y: position.y + 30*math.Sin(direction+4*math.Pi/3),
+		x: position.x + corner*math.Cos(direction+4*math.Pi/3),
+		y: position.y + corner*math.Sin(direction+4*math.Pi/3),
 	}
 
 	return point1, point2, point3
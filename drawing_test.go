@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestComputeTrianglePoints checks that the drawn triangle points along the velocity and scales with the boid size
+func TestComputeTrianglePoints(t *testing.T) {
+	position, velocity := OrderedPair{x: 100, y: 50}, OrderedPair{x: 0, y: 3}
+
+	for _, size := range []float64{1, 5, 12.5} {
+		tip, left, right := ComputeTrianglePoints(position, velocity, size)
+
+		if math.Abs(tip.x-position.x) > 1e-9 || math.Abs(tip.y-(position.y+16*size)) > 1e-9 {
+			t.Errorf("size %v: tip = %v, want %v ahead of %v", size, tip, 16*size, position)
+		}
+		for _, corner := range []OrderedPair{left, right} {
+			if d := Distance(position, corner); math.Abs(d-6*size) > 1e-9 {
+				t.Errorf("size %v: corner %v is %v from the boid, want %v", size, corner, d, 6*size)
+			}
+		}
+	}
+
+	// the default size draws the original 80 by 30 triangle
+	tip, left, _ := ComputeTrianglePoints(position, velocity, DefaultParameters().BoidSize)
+	if Distance(position, tip) != 80 || math.Abs(Distance(position, left)-30) > 1e-9 {
+		t.Errorf("default size: tip %v and corner %v, want 80 and 30 from the boid", tip, left)
+	}
+}
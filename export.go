@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TrajectoryWriter writes the state of every boid in the sampled generations of a run, for analysis outside of Go.
+// Each boid of each sampled generation becomes one row (generation, boid id, x, y, vx, vy, ax, ay) in one of three formats:
+//   - csv: a header line followed by comma-separated rows
+//   - ndjson: one JSON object per row
+//   - columnar: one gzip member per generation, holding the columns of that generation as little-endian binary
+//     (see WriteColumnarFrame); the members concatenate into a single file that gzip reads as one stream
+//
+// Numbers are written with as many digits as needed to read back exactly the same float64.
+type TrajectoryWriter struct {
+	SeriesFile
+	format string
+}
+
+// SeriesWriter is an output file that gets rows for some of the generations of a run.
+// Size tells how far it has been written, so that a resumed run can continue it from a checkpoint.
+type SeriesWriter interface {
+	WriteSky(frame *SeriesFrame) error
+	Size() (int64, error)
+	Close() error
+}
+
+// SeriesFrame is one generation of a run, handed to every SeriesWriter that writes it.
+// The flocks of the sky are found once, by the first writer that asks for them, and shared with the others.
+type SeriesFrame struct {
+	Generation int
+	Sky        Sky
+	flocks     []Flock
+	found      bool
+}
+
+// NewSeriesFrame returns the frame of current_sky at generation gen
+func NewSeriesFrame(gen int, current_sky Sky) *SeriesFrame {
+	return &SeriesFrame{Generation: gen, Sky: current_sky}
+}
+
+// Flocks returns the flocks of the sky of the frame, as found by FindFlocks
+func (frame *SeriesFrame) Flocks() []Flock {
+	if !frame.found {
+		// the grid is kept for the other measures of the frame
+		if frame.Sky.grid == nil && len(frame.Sky.boids) > 0 {
+			frame.Sky.grid = BuildSpatialGrid(frame.Sky)
+		}
+		frame.flocks, frame.found = FindFlocks(frame.Sky), true
+	}
+	return frame.flocks
+}
+
+// SeriesFile is the buffered file behind every SeriesWriter: a new file starting with its header,
+// or the file of an interrupted run continued where its checkpoint left it. It is flushed after every generation.
+type SeriesFile struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// CreateSeriesFile creates filename and writes header to it
+func CreateSeriesFile(filename, header string) (SeriesFile, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return SeriesFile{}, err
+	}
+
+	s := SeriesFile{file: f, w: bufio.NewWriter(f)}
+	s.w.WriteString(header)
+
+	return s, nil
+}
+
+// ReopenSeriesFile reopens the file of an interrupted run, keeping its first size bytes (as returned by Size)
+func ReopenSeriesFile(filename string, size int64) (SeriesFile, error) {
+	f, err := ReopenFile(filename, size)
+	if err != nil {
+		return SeriesFile{}, err
+	}
+
+	return SeriesFile{file: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Size returns the number of bytes written so far, which is where ReopenSeriesFile can continue the file
+func (s SeriesFile) Size() (int64, error) {
+	if err := s.w.Flush(); err != nil {
+		return 0, err
+	}
+	return s.file.Seek(0, io.SeekCurrent)
+}
+
+// Close flushes the rows and closes the file
+func (s SeriesFile) Close() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// TrajectoryFormats lists the formats accepted by CreateTrajectory
+var TrajectoryFormats = []string{"csv", "ndjson", "columnar"}
+
+// columnarMagic starts every generation of a columnar trajectory
+const columnarMagic = "BTRJ"
+
+// TrajectoryFile returns the name of the trajectory file in the given format for the output file prefix output_file
+func TrajectoryFile(output_file, format string) string {
+	if format == "columnar" {
+		return output_file + ".trajectory.columnar.gz"
+	}
+	return output_file + ".trajectory." + format
+}
+
+// ParseTrajectoryFormats splits a comma-separated list of trajectory formats, rejecting unknown ones
+func ParseTrajectoryFormats(list string) ([]string, error) {
+	var formats []string
+
+	for _, format := range strings.Split(list, ",") {
+		format = strings.TrimSpace(format)
+		if format == "" {
+			continue
+		}
+
+		known := false
+		for _, f := range TrajectoryFormats {
+			known = known || f == format
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown trajectory format %q (want %s)", format, strings.Join(TrajectoryFormats, ", "))
+		}
+
+		formats = append(formats, format)
+	}
+
+	return formats, nil
+}
+
+// CreateTrajectory creates filename and prepares it for a trajectory in the given format
+func CreateTrajectory(filename, format string) (*TrajectoryWriter, error) {
+	header := ""
+	if format == "csv" {
+		header = "generation,boid,x,y,vx,vy,ax,ay\n"
+	}
+
+	file, err := CreateSeriesFile(filename, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrajectoryWriter{SeriesFile: file, format: format}, nil
+}
+
+// OpenTrajectory reopens a trajectory file of an interrupted run, keeping its first size bytes (as returned by Size)
+func OpenTrajectory(filename, format string, size int64) (*TrajectoryWriter, error) {
+	file, err := ReopenSeriesFile(filename, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrajectoryWriter{SeriesFile: file, format: format}, nil
+}
+
+// WriteSky writes the rows of every boid of the sky of frame
+func (t *TrajectoryWriter) WriteSky(frame *SeriesFrame) error {
+	gen, current_sky := frame.Generation, frame.Sky
+
+	switch t.format {
+	case "csv":
+		for _, b := range current_sky.boids {
+			row := []string{strconv.Itoa(gen), strconv.Itoa(b.id), FormatFloat(b.position.x), FormatFloat(b.position.y),
+				FormatFloat(b.velocity.x), FormatFloat(b.velocity.y), FormatFloat(b.acceleration.x), FormatFloat(b.acceleration.y)}
+			t.w.WriteString(strings.Join(row, ","))
+			t.w.WriteByte('\n')
+		}
+
+	case "ndjson":
+		for _, b := range current_sky.boids {
+			fmt.Fprintf(t.w, `{"generation":%d,"boid":%d,"x":%s,"y":%s,"vx":%s,"vy":%s,"ax":%s,"ay":%s}`+"\n",
+				gen, b.id, FormatFloat(b.position.x), FormatFloat(b.position.y),
+				FormatFloat(b.velocity.x), FormatFloat(b.velocity.y), FormatFloat(b.acceleration.x), FormatFloat(b.acceleration.y))
+		}
+
+	case "columnar":
+		// one gzip member per generation, so that an interrupted file can be cut after any generation
+		compressor := gzip.NewWriter(t.w)
+		if err := WriteColumnarFrame(compressor, gen, current_sky); err != nil {
+			return err
+		}
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+
+	return t.w.Flush()
+}
+
+// FormatFloat writes x with the fewest digits that read back as exactly x
+func FormatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// WriteColumnarFrame writes one generation of a columnar trajectory: the magic "BTRJ", the generation (int64)
+// and the number of boids n (uint64), followed by the columns boid id (n int64), x, y, vx, vy, ax and ay (n float64 each).
+func WriteColumnarFrame(w io.Writer, gen int, current_sky Sky) error {
+	n := len(current_sky.boids)
+
+	if _, err := io.WriteString(w, columnarMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, [2]uint64{uint64(gen), uint64(n)}); err != nil {
+		return err
+	}
+
+	ids := make([]int64, n)
+	for i, b := range current_sky.boids {
+		ids[i] = int64(b.id)
+	}
+	if err := binary.Write(w, binary.LittleEndian, ids); err != nil {
+		return err
+	}
+
+	columns := []func(b Boid) float64{
+		func(b Boid) float64 { return b.position.x },
+		func(b Boid) float64 { return b.position.y },
+		func(b Boid) float64 { return b.velocity.x },
+		func(b Boid) float64 { return b.velocity.y },
+		func(b Boid) float64 { return b.acceleration.x },
+		func(b Boid) float64 { return b.acceleration.y },
+	}
+
+	column := make([]float64, n)
+	for _, value := range columns {
+		for i, b := range current_sky.boids {
+			column[i] = value(b)
+		}
+		if err := binary.Write(w, binary.LittleEndian, column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrajectoryFrame holds the columns of one generation read back from a columnar trajectory
+type TrajectoryFrame struct {
+	Generation           int
+	Boid                 []int64
+	X, Y, VX, VY, AX, AY []float64
+}
+
+// ReadColumnarTrajectory reads every generation of a columnar trajectory file
+func ReadColumnarTrajectory(filename string) ([]TrajectoryFrame, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decompressor, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []TrajectoryFrame
+	for {
+		magic := make([]byte, len(columnarMagic))
+		if _, err := io.ReadFull(decompressor, magic); errors.Is(err, io.EOF) {
+			return frames, nil
+		} else if err != nil {
+			return frames, err
+		}
+		if string(magic) != columnarMagic {
+			return frames, errors.New("not a columnar trajectory")
+		}
+
+		var header [2]uint64
+		if err := binary.Read(decompressor, binary.LittleEndian, &header); err != nil {
+			return frames, err
+		}
+
+		n := header[1]
+		if n > math.MaxInt32 {
+			return frames, fmt.Errorf("implausible number of boids %d", n)
+		}
+
+		frame := TrajectoryFrame{Generation: int(header[0]), Boid: make([]int64, n)}
+		if err := binary.Read(decompressor, binary.LittleEndian, frame.Boid); err != nil {
+			return frames, err
+		}
+		for _, column := range []*[]float64{&frame.X, &frame.Y, &frame.VX, &frame.VY, &frame.AX, &frame.AY} {
+			*column = make([]float64, n)
+			if err := binary.Read(decompressor, binary.LittleEndian, *column); err != nil {
+				return frames, err
+			}
+		}
+
+		frames = append(frames, frame)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestTrajectoryFormats writes two generations in every trajectory format
+// and checks that each row reads back as exactly the state of its boid
+func TestTrajectoryFormats(t *testing.T) {
+	first_sky := GenerateRandomSky(20, 600, 300, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 5)
+	second_sky := UpdateSkyOrFail(t, first_sky, 1.0, 1)
+	skies := map[int]Sky{0: first_sky, 7: second_sky}
+
+	dir := t.TempDir()
+	for _, format := range TrajectoryFormats {
+		writer, err := CreateTrajectory(TrajectoryFile(filepath.Join(dir, "run"), format), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, gen := range []int{0, 7} {
+			if err := writer.WriteSky(NewSeriesFrame(gen, skies[gen])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every format is turned into rows of generation, boid, x, y, vx, vy, ax, ay
+	rows := make(map[string][][8]float64)
+
+	csv_file, _ := os.Open(TrajectoryFile(filepath.Join(dir, "run"), "csv"))
+	scanner := bufio.NewScanner(csv_file)
+	scanner.Scan()
+	if header := scanner.Text(); header != "generation,boid,x,y,vx,vy,ax,ay" {
+		t.Errorf("CSV header %q", header)
+	}
+	for scanner.Scan() {
+		var row [8]float64
+		for k, field := range strings.Split(scanner.Text(), ",") {
+			row[k], _ = strconv.ParseFloat(field, 64)
+		}
+		rows["csv"] = append(rows["csv"], row)
+	}
+	csv_file.Close()
+
+	ndjson_file, _ := os.Open(TrajectoryFile(filepath.Join(dir, "run"), "ndjson"))
+	decoder := json.NewDecoder(ndjson_file)
+	for decoder.More() {
+		var record map[string]float64
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		rows["ndjson"] = append(rows["ndjson"], [8]float64{record["generation"], record["boid"],
+			record["x"], record["y"], record["vx"], record["vy"], record["ax"], record["ay"]})
+	}
+	ndjson_file.Close()
+
+	frames, err := ReadColumnarTrajectory(TrajectoryFile(filepath.Join(dir, "run"), "columnar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range frames {
+		for i := range frame.Boid {
+			rows["columnar"] = append(rows["columnar"], [8]float64{float64(frame.Generation), float64(frame.Boid[i]),
+				frame.X[i], frame.Y[i], frame.VX[i], frame.VY[i], frame.AX[i], frame.AY[i]})
+		}
+	}
+
+	for _, format := range TrajectoryFormats {
+		if len(rows[format]) != 2*len(first_sky.boids) {
+			t.Errorf("%s trajectory has %d rows, want %d", format, len(rows[format]), 2*len(first_sky.boids))
+			continue
+		}
+
+		for _, row := range rows[format] {
+			b := skies[int(row[0])].boids[int(row[1])]
+			want := [8]float64{row[0], row[1], b.position.x, b.position.y, b.velocity.x, b.velocity.y, b.acceleration.x, b.acceleration.y}
+			if row != want {
+				t.Errorf("%s trajectory row %v, want %v", format, row, want)
+			}
+		}
+	}
+}
+
+// TestParseTrajectoryFormats checks the -trajectory list
+func TestParseTrajectoryFormats(t *testing.T) {
+	formats, err := ParseTrajectoryFormats(" csv,columnar ,")
+	if err != nil || strings.Join(formats, ",") != "csv,columnar" {
+		t.Errorf("ParseTrajectoryFormats = %v, %v", formats, err)
+	}
+
+	if _, err := ParseTrajectoryFormats("csv,parquet"); err == nil {
+		t.Error("ParseTrajectoryFormats accepted an unknown format")
+	}
+}
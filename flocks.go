@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flock is one connected group of boids: boids closer than proximity belong to the same flock,
+// and so do boids linked through a chain of such neighbors. A lone boid is a flock of size 1.
+type Flock struct {
+	Members  []int       // ids of the boids of the flock, ascending
+	Centroid OrderedPair // center of the flock, across the edges of a wrapping sky
+	Velocity OrderedPair // mean velocity of the boids of the flock
+	Heading  float64     // direction of Velocity in radians, from -pi to pi
+}
+
+// flocksHeader is the first line of a flocks CSV file
+const flocksHeader = "generation,flock,size,x,y,vx,vy,heading"
+
+// FindFlocks splits the boids of current_sky into flocks, largest first (flocks of the same size ordered by their smallest id).
+// Distances go across the edges of a wrapping sky, so a flock crossing an edge is found as one flock.
+func FindFlocks(current_sky Sky) []Flock {
+	n := len(current_sky.boids)
+	if n == 0 {
+		return nil
+	}
+
+	if current_sky.grid == nil {
+		current_sky.grid = BuildSpatialGrid(current_sky)
+	}
+
+	// union-find over the boid indices, linking every pair of neighbors
+	parent := make([]int, n)
+	size := make([]int, n)
+	for i := range parent {
+		parent[i], size[i] = i, 1
+	}
+
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	for i, b := range current_sky.boids {
+		for _, j := range NeighborCandidates(current_sky, b.position) {
+			if j <= i {
+				continue
+			}
+
+			other := current_sky.boids[j]
+			if Distance(b.position, MinimumImage(current_sky, b.position, other.position)) >= current_sky.proximity {
+				continue
+			}
+
+			root_i, root_j := find(i), find(j)
+			if root_i == root_j {
+				continue
+			}
+			if size[root_i] < size[root_j] {
+				root_i, root_j = root_j, root_i
+			}
+			parent[root_j] = root_i
+			size[root_i] += size[root_j]
+		}
+	}
+
+	// gather the boids of each component, in index order
+	members := make(map[int][]Boid)
+	var roots []int
+	for i, b := range current_sky.boids {
+		root := find(i)
+		if members[root] == nil {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], b)
+	}
+
+	flocks := make([]Flock, 0, len(roots))
+	for _, root := range roots {
+		flock_sky := current_sky
+		flock_sky.boids = members[root]
+		flock_sky.grid = nil
+
+		var flock Flock
+		flock.Centroid = SkyCentroid(flock_sky)
+		for _, b := range members[root] {
+			flock.Members = append(flock.Members, b.id)
+			flock.Velocity.x += b.velocity.x
+			flock.Velocity.y += b.velocity.y
+		}
+		flock.Velocity.x /= float64(len(members[root]))
+		flock.Velocity.y /= float64(len(members[root]))
+		flock.Heading = math.Atan2(flock.Velocity.y, flock.Velocity.x)
+		sort.Ints(flock.Members)
+
+		flocks = append(flocks, flock)
+	}
+
+	sort.Slice(flocks, func(i, j int) bool {
+		if len(flocks[i].Members) != len(flocks[j].Members) {
+			return len(flocks[i].Members) > len(flocks[j].Members)
+		}
+		return flocks[i].Members[0] < flocks[j].Members[0]
+	})
+
+	return flocks
+}
+
+// FlocksWriter writes the flocks of every sampled generation as CSV rows, one per flock, largest flock first
+type FlocksWriter struct {
+	SeriesFile
+}
+
+// FlocksFile returns the name of the flocks CSV file for the output file prefix output_file
+func FlocksFile(output_file string) string {
+	return output_file + ".flocks.csv"
+}
+
+// CreateFlocks creates filename and writes the CSV header
+func CreateFlocks(filename string) (*FlocksWriter, error) {
+	file, err := CreateSeriesFile(filename, flocksHeader+"\n")
+	if err != nil {
+		return nil, err
+	}
+	return &FlocksWriter{SeriesFile: file}, nil
+}
+
+// OpenFlocks reopens the flocks file of an interrupted run, keeping its first size bytes (as returned by Size)
+func OpenFlocks(filename string, size int64) (*FlocksWriter, error) {
+	file, err := ReopenSeriesFile(filename, size)
+	if err != nil {
+		return nil, err
+	}
+	return &FlocksWriter{SeriesFile: file}, nil
+}
+
+// WriteSky writes the flocks of the sky of frame
+func (fw *FlocksWriter) WriteSky(frame *SeriesFrame) error {
+	for k, flock := range frame.Flocks() {
+		row := []string{strconv.Itoa(frame.Generation), strconv.Itoa(k), strconv.Itoa(len(flock.Members)),
+			FormatFloat(flock.Centroid.x), FormatFloat(flock.Centroid.y),
+			FormatFloat(flock.Velocity.x), FormatFloat(flock.Velocity.y), FormatFloat(flock.Heading)}
+		fw.w.WriteString(strings.Join(row, ","))
+		fw.w.WriteByte('\n')
+	}
+
+	return fw.w.Flush()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestFindFlocks checks the flocks of a sky with a chain of boids across the wrapped corner,
+// a pair flying together, and a lone boid
+func TestFindFlocks(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 5}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+		// chain through the corner: 98,98 -> 1,99 -> 2,2 ; the last link is 3 apart across the top edge
+		{id: 1, position: OrderedPair{x: 98, y: 98}, velocity: OrderedPair{x: 0, y: 1}},
+		{id: 2, position: OrderedPair{x: 20, y: 20}, velocity: OrderedPair{x: 0, y: -1}},
+		{id: 3, position: OrderedPair{x: 1, y: 99}, velocity: OrderedPair{x: 0, y: 1}},
+		{id: 4, position: OrderedPair{x: 23, y: 20}, velocity: OrderedPair{x: 0, y: -1}},
+		{id: 5, position: OrderedPair{x: 2, y: 2}, velocity: OrderedPair{x: 0, y: 1}},
+	}
+
+	flocks := FindFlocks(sky)
+	if len(flocks) != 3 {
+		t.Fatalf("FindFlocks found %d flocks, want 3: %+v", len(flocks), flocks)
+	}
+
+	want_members := [][]int{{1, 3, 5}, {2, 4}, {0}}
+	for k, flock := range flocks {
+		if !reflect.DeepEqual(flock.Members, want_members[k]) {
+			t.Errorf("flock %d has boids %v, want %v", k, flock.Members, want_members[k])
+		}
+	}
+
+	// the chain is centered near the corner, not in the middle of the sky
+	centroid := flocks[0].Centroid
+	if math.Min(centroid.x, 100-centroid.x) > 3 || math.Min(centroid.y, 100-centroid.y) > 3 {
+		t.Errorf("centroid of the corner flock at %v", centroid)
+	}
+	if math.Abs(flocks[0].Heading-math.Pi/2) > 1e-12 || math.Abs(flocks[1].Heading+math.Pi/2) > 1e-12 {
+		t.Errorf("headings %v and %v, want pi/2 and -pi/2", flocks[0].Heading, flocks[1].Heading)
+	}
+	if math.Abs(flocks[1].Centroid.x-21.5) > 1e-9 || math.Abs(flocks[1].Centroid.y-20) > 1e-9 {
+		t.Errorf("centroid of the pair %v, want (21.5, 20)", flocks[1].Centroid)
+	}
+
+	// without wrapping the chain falls apart
+	sky.boundary = ReflectBoundary
+	if flocks := FindFlocks(sky); len(flocks) != 5 {
+		t.Errorf("FindFlocks on a reflecting sky found %d flocks, want 5", len(flocks))
+	}
+}
+
+// TestSeriesFrameFlocks checks that the metrics and flocks writers of one generation share the flocks of their frame,
+// and that the shared flocks give the same metrics as ComputeFlockMetrics
+func TestSeriesFrameFlocks(t *testing.T) {
+	sky := GenerateRandomSky(100, 400, 400, 1.0, 2.0, 40, 1.5, 1.0, 0.02, 9)
+	frame := NewSeriesFrame(3, sky)
+
+	flocks := frame.Flocks()
+	if again := frame.Flocks(); len(flocks) == 0 || &again[0] != &flocks[0] {
+		t.Errorf("SeriesFrame.Flocks found the flocks again instead of sharing them")
+	}
+	if !reflect.DeepEqual(flocks, FindFlocks(sky)) {
+		t.Errorf("SeriesFrame.Flocks differs from FindFlocks")
+	}
+	if metrics := FlockMetricsOf(frame.Sky, flocks); metrics != ComputeFlockMetrics(sky) {
+		t.Errorf("FlockMetricsOf the shared flocks = %+v, want %+v", metrics, ComputeFlockMetrics(sky))
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"math"
-	"math/rand"
-	"time"
+	"runtime"
+	"sync"
 )
 
 //place your non-drawing functions here.
@@ -17,35 +18,198 @@ func Distance(b1_pos, b2_pos OrderedPair) float64 {
 	return math.Sqrt(delta_x * delta_x + delta_y * delta_y)
 }
 
+// Calculate the distance between two points on a sky that wraps around at sky_width and sky_height,
+// i.e. the distance to the nearest periodic image of b2_pos
+func ToroidalDistance(b1_pos, b2_pos OrderedPair, sky_width, sky_height float64) float64 {
+	return Distance(b1_pos, NearestImage(b1_pos, b2_pos, sky_width, sky_height))
+}
+
+// Return the copy of b2_pos, shifted by whole sky widths in x and whole sky heights in y, that lies closest to b1_pos (minimum image)
+// Points less than half a sky width (height) apart in x (y) are returned unchanged
+func NearestImage(b1_pos, b2_pos OrderedPair, sky_width, sky_height float64) OrderedPair {
+	image := b2_pos
+
+	if shift_x := math.Round((b2_pos.x - b1_pos.x) / sky_width); shift_x != 0 {
+		image.x = b2_pos.x - shift_x * sky_width
+	}
+	if shift_y := math.Round((b2_pos.y - b1_pos.y) / sky_height); shift_y != 0 {
+		image.y = b2_pos.y - shift_y * sky_height
+	}
+
+	return image
+}
+
 //Return a slice of Sky objects representing the time evolution of the boid system
-func SimulateBoids(initial_sky Sky, num_gens int, time_step float64) []Sky {
-	time_steps := make([]Sky, num_gens + 1)
-	time_steps[0] = initial_sky
+// If parallel is true, every generation is computed by GOMAXPROCS goroutines
+// The error is that of StreamBoids; the skies computed before it are still returned
+func SimulateBoids(initial_sky Sky, num_gens int, time_step float64, parallel bool) ([]Sky, error) {
+	time_steps := make([]Sky, 0, max(num_gens + 1, 1))
+
+	err := StreamBoids(initial_sky, num_gens, time_step, parallel, func(gen int, sky Sky) error {
+		time_steps = append(time_steps, sky)
+		return nil
+	})
+
+	return time_steps, err
+}
+
+// StreamBoids runs the same simulation as SimulateBoids, but passes every generation (starting with initial_sky as generation 0)
+// to visit as soon as it is computed instead of keeping it, so memory does not grow with num_gens.
+// The simulation stops at the first error returned by visit, and that error is returned.
+// It also refuses skies and time steps that cannot be simulated, and stops at the first generation
+// in which a boid is no longer finite (for instance after forces blew up), instead of carrying on with NaNs.
+func StreamBoids(initial_sky Sky, num_gens int, time_step float64, parallel bool, visit func(gen int, sky Sky) error) error {
+	if err := ValidateSky(initial_sky); err != nil {
+		return err
+	}
+	if !(time_step > 0) || math.IsInf(time_step, 0) || num_gens < 0 {
+		return fmt.Errorf("%w: time step %v and number of generations %d", ErrInvalidParameters, time_step, num_gens)
+	}
+
+	num_workers := 1
+	if parallel {
+		num_workers = runtime.GOMAXPROCS(0)
+	}
+
+	current_sky := initial_sky
+	if err := visit(0, current_sky); err != nil {
+		return err
+	}
 
 	for i := 1; i < (num_gens + 1); i++ {
-		time_steps[i] = UpdateSky(time_steps[i-1], time_step)
+		var err error
+		if current_sky, err = UpdateSkyParallel(current_sky, time_step, num_workers); err != nil {
+			return fmt.Errorf("generation %d: %w", i, err)
+		}
+
+		if err := visit(i, current_sky); err != nil {
+			return err
+		}
 	}
 
-	return time_steps
+	return nil
 }
 
 // UpdateSky takes in the current sky and time step, and returns the updated sky after one time step
-func UpdateSky(current_sky Sky, time_step float64) Sky {
+// If the step of a boid or a predator is not finite, the error wraps ErrNotFinite: the step of the boids stops
+// before the edges of the sky, the obstacles and the predators act, and the sky returned is not to be simulated further
+func UpdateSky(current_sky Sky, time_step float64) (Sky, error) {
+	return UpdateSkyParallel(current_sky, time_step, 1)
+}
+
+// UpdateSkyParallel returns the same sky as UpdateSky, but splits the boids into num_workers contiguous blocks
+// that are updated by separate goroutines. Every boid only reads current_sky and writes its own slot of new_sky,
+// so each boid goes through exactly the same arithmetic as in the serial version.
+func UpdateSkyParallel(current_sky Sky, time_step float64, num_workers int) (Sky, error) {
 	new_sky := CopySky(current_sky)
 
-	max_speed := current_sky.maxBoidSpeed
-	sky_width := current_sky.width
+	// index the current positions once, so each boid only looks at the boids in nearby cells
+	current_sky.grid = BuildSpatialGrid(current_sky)
+	// the random turns of the Vicsek model are drawn serially, before the boids are split into blocks
+	noise := DrawNoise(current_sky)
 
+	if err := UpdateBoids(current_sky, new_sky, noise, time_step, num_workers); err != nil {
+		return new_sky, err
+	}
 
-	for i, b := range new_sky.boids {
-		old_acceleration, old_velocity := b.acceleration, b.velocity
+	// the few predators are moved serially, after all the boids
+	UpdatePredators(current_sky, new_sky, time_step)
+	for _, p := range new_sky.predators {
+		if err := CheckFiniteBoid("predator", p); err != nil {
+			return new_sky, err
+		}
+	}
 
-		new_sky.boids[i].acceleration = UpdateAcceleration(current_sky, i)
-		new_sky.boids[i].velocity = UpdateVelocity(new_sky.boids[i], old_acceleration, max_speed, time_step)
-		new_sky.boids[i].position = UpdatePosition(new_sky.boids[i], old_acceleration, old_velocity, sky_width, time_step)
+	return CatchBoids(new_sky), nil
+}
+
+// UpdateBoids moves the boids of new_sky (a copy of current_sky) forward by one time step with the integrator of the sky,
+// computing the forces in num_workers blocks of boids, then keeps each boid under its speed limit, inside the sky and out of obstacles
+// In the Vicsek model boid i instead takes a new heading, turned by noise[i] (see DrawNoise)
+// The first boid whose step is not finite is returned as an error, and the boids are left as stepped
+func UpdateBoids(current_sky, new_sky Sky, noise []float64, time_step float64, num_workers int) error {
+	var stepped []Boid
+
+	if current_sky.model == VicsekModel {
+		stepped = make([]Boid, len(current_sky.boids))
+		ForEachBlock(len(stepped), num_workers, func(start, end int) {
+			for i := start; i < end; i++ {
+				turn := 0.0
+				if noise != nil {
+					turn = noise[i]
+				}
+				stepped[i] = VicsekUpdate(current_sky, i, turn, time_step)
+			}
+		})
+	} else {
+		// the forces on the current boids use the grid built above; trial positions of the boids are indexed anew
+		accelerations := func(boids []Boid, start bool) []OrderedPair {
+			if start {
+				return ComputeAccelerations(current_sky, num_workers)
+			}
+			trial_sky := current_sky
+			trial_sky.boids = boids
+			trial_sky.grid = BuildSpatialGrid(trial_sky)
+			return ComputeAccelerations(trial_sky, num_workers)
+		}
+		max_speed := func(b Boid) float64 {
+			return SpeciesMaxSpeed(current_sky, b.species)
+		}
+		stepped = SkyIntegrator(current_sky).Step(current_sky.boids, accelerations, max_speed, time_step)
 	}
 
-	return new_sky
+	// edges and obstacles cannot place a boid that is no longer a finite number
+	copy(new_sky.boids, stepped)
+	for _, b := range stepped {
+		if err := CheckFiniteBoid("boid", b); err != nil {
+			return err
+		}
+	}
+
+	ForEachBlock(len(new_sky.boids), num_workers, func(start, end int) {
+		for i := start; i < end; i++ {
+			new_sky.boids[i] = StopAtObstacles(new_sky.boids[i], current_sky.boids[i].position, current_sky)
+			new_sky.boids[i] = ApplyBoundary(new_sky.boids[i], current_sky)
+			new_sky.boids[i] = ResolveObstacles(new_sky.boids[i], current_sky)
+		}
+	})
+
+	return nil
+}
+
+// ComputeAccelerations returns the acceleration of every boid of current_sky, computed in num_workers blocks of boids
+func ComputeAccelerations(current_sky Sky, num_workers int) []OrderedPair {
+	accelerations := make([]OrderedPair, len(current_sky.boids))
+
+	ForEachBlock(len(current_sky.boids), num_workers, func(start, end int) {
+		for i := start; i < end; i++ {
+			accelerations[i] = UpdateAcceleration(current_sky, i)
+		}
+	})
+
+	return accelerations
+}
+
+// ForEachBlock splits indices 0 to num-1 into at most num_workers contiguous blocks and calls work on each block
+// in its own goroutine, returning when every block is done. A single block runs in the calling goroutine.
+func ForEachBlock(num, num_workers int, work func(start, end int)) {
+	num_workers = max(1, min(num_workers, num))
+	if num_workers == 1 {
+		work(0, num)
+		return
+	}
+	block_size := (num + num_workers - 1) / num_workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < num; start += block_size {
+		end := min(start+block_size, num)
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			work(start, end)
+		}(start, end)
+	}
+	wg.Wait()
 }
 
 // Update the acceleration of boid i (index) in current_sky
@@ -81,84 +245,101 @@ func UpdateVelocity(b Boid, old_acceleration OrderedPair, MaxBoidSpeed, time_ste
 	return velo
 }
 
-// Update the position of boid b given its old acceleration, old velocity, sky width and time step
-func UpdatePosition(b Boid, old_acceleration, old_velocity OrderedPair, SkyWidth, time_step float64) OrderedPair {
+// Update the position of boid b given its old acceleration, old velocity and time step
+// The edges of the sky and the obstacles are applied afterwards by StopAtObstacles, ApplyBoundary and ResolveObstacles
+func UpdatePosition(b Boid, old_acceleration, old_velocity OrderedPair, time_step float64) OrderedPair {
 	var pos OrderedPair
 	
 	pos.x = b.position.x + old_velocity.x * time_step + 0.5 * old_acceleration.x * time_step * time_step
 	pos.y = b.position.y + old_velocity.y * time_step + 0.5 * old_acceleration.y * time_step * time_step
-	
-	// wrap around the sky if the boid goes out of bounds
-	// it may not work if directly add/ substract SkyWidth to pos.x or pos.y
-	if pos.x == SkyWidth {
-		pos.x = pos.x
-	} else {
-		pos.x = math.Mod(pos.x + SkyWidth, SkyWidth)
-	}
-	
-	if pos.y == SkyWidth {
-		pos.y = pos.y
-	} else {
-		pos.y = math.Mod(pos.y + SkyWidth, SkyWidth)
-	}
-	
 
 	return pos
 }
 
-// Compute the net force on boid b from all other boids in current_sky
+// Compute the net force on boid b from all other boids in current_sky, plus the push of soft walls and obstacles
+// and the flight from predators
+// Each enabled rule (separation, alignment and cohesion by default) gets the neighbors inside its vision cone,
+// with the rule's factor for each pair of species, and its force is added multiplied by the rule's weight
+// The force model of the sky decides the form of the classic rules (see ModelRule)
 func ComputeNetForce(current_sky Sky, b Boid) OrderedPair {
-	var sep_force, align_force, coh_force OrderedPair
 	var force OrderedPair
-	neighbor_count := 0
 
-	for i := range current_sky.boids {
-		if current_sky.boids[i] != b {
-			S := current_sky.separationFactor
-			A := current_sky.alignmentFactor
-			C := current_sky.cohesionFactor
-			R := current_sky.proximity
-			
-			d := Distance(b.position, current_sky.boids[i].position)
-
-			// birds in same position: force = 0
-			if d == 0 {
-				continue
-			}
+	in_range := NeighborsInRange(current_sky, b)
 
-			// check whether two birds are within the proximity distance
-			if d < R {
-				neighbor_count++ // neighbor_count whithin proximity distance, used to average the forces later
-				s_force := ComputeSeparationForce(b, current_sky.boids[i], S, d)
-				a_force := ComputeAlignmentForce(b, current_sky.boids[i], A, d)
-				c_force := ComputeCohesionForce(b, current_sky.boids[i], C, d)
-
-				sep_force.x += s_force.x
-				sep_force.y += s_force.y
-				align_force.x += a_force.x
-				align_force.y += a_force.y
-				coh_force.x += c_force.x
-				coh_force.y += c_force.y
+	// each rule sees the neighbors in its own cone, and averages over them
+	for _, setting := range SkyRules(current_sky) {
+		rule, ok := ModelRule(current_sky, setting.Name, b.species)
+		if !setting.Enabled || !ok {
+			continue
+		}
+
+		angle := RuleAngle(current_sky.vision, setting.Name)
+		in_view := make([]Neighbor, 0, len(in_range))
+		for _, n := range in_range {
+			// birds in same position: force = 0, as a neighbor at distance 0 gives no direction to steer by
+			if n.Distance > 0 && InView(b, n.Boid.position, angle) {
+				n.Factor = RuleFactor(current_sky, setting.Name, b.species, n.Boid.species)
+				in_view = append(in_view, n)
 			}
 		}
+
+		rule_force := rule.Force(b, in_view)
+		force.x += setting.Weight * rule_force.x
+		force.y += setting.Weight * rule_force.y
 	}
 
-	// average the forces
-	if neighbor_count > 0 {
-		sep_force.x /= float64(neighbor_count)
-		sep_force.y /= float64(neighbor_count)
-		align_force.x /= float64(neighbor_count)
-		align_force.y /= float64(neighbor_count)
-		coh_force.x /= float64(neighbor_count)
-		coh_force.y /= float64(neighbor_count)
-	}			
-	
-	force.x += (sep_force.x + align_force.x + coh_force.x)
-	force.y += (sep_force.y + align_force.y + coh_force.y)
+	wall_force := ComputeWallForce(current_sky, b)
+	force.x += wall_force.x
+	force.y += wall_force.y
+
+	obstacle_force := ComputeObstacleForce(current_sky, b)
+	force.x += obstacle_force.x
+	force.y += obstacle_force.y
+
+	flee_force := ComputeFleeForce(current_sky, b)
+	force.x += flee_force.x
+	force.y += flee_force.y
 
 	return force
 }
 
+// NeighborsInRange returns the neighbors of boid b in current_sky, before any vision cone, with their distances to b
+// b itself is recognized by its id, so another boid in exactly the same state is not mistaken for b,
+// and a boid at the same position as b is a neighbor at distance 0
+// On a wrapping sky every other boid acts from its periodic image nearest to b
+// If current_sky has a spatial grid, only boids in the cells around b are examined
+// The proximity is that of b's species
+// In the topological mode the neighbors are the numNeighbors nearest boids instead of those within proximity
+func NeighborsInRange(current_sky Sky, b Boid) []Neighbor {
+	topological := current_sky.neighborMode == TopologicalNeighbors
+	var neighbors []int
+	if topological {
+		neighbors = NearestNeighbors(current_sky, b, current_sky.numNeighbors)
+	} else {
+		neighbors = NeighborCandidates(current_sky, b.position)
+	}
+
+	_, _, _, R := InteractionFactors(current_sky, b.species, b.species)
+
+	var in_range []Neighbor
+	for _, i := range neighbors {
+		if current_sky.boids[i].id != b.id {
+			// a boid just across an edge acts as if it were on this side of the edge
+			other := current_sky.boids[i]
+			other.position = MinimumImage(current_sky, b.position, other.position)
+
+			d := Distance(b.position, other.position)
+
+			// check whether two birds are within the proximity distance
+			if d < R || topological {
+				in_range = append(in_range, Neighbor{Boid: other, Distance: d})
+			}
+		}
+	}
+
+	return in_range
+}
+
 // Compute the separation force exerted on boid b1 by boid b2
 func ComputeSeparationForce(b1, b2 Boid, S, distance float64) OrderedPair {
 	var s_force OrderedPair
@@ -195,23 +376,58 @@ func CopySky(current_sky Sky) Sky {
 	var new_sky Sky
 
 	new_sky.width = current_sky.width
+	new_sky.height = current_sky.height
 	new_sky.proximity = current_sky.proximity
 	new_sky.separationFactor = current_sky.separationFactor
 	new_sky.alignmentFactor = current_sky.alignmentFactor
 	new_sky.cohesionFactor = current_sky.cohesionFactor
 	new_sky.maxBoidSpeed = current_sky.maxBoidSpeed
+	new_sky.boundary = current_sky.boundary
+	new_sky.wallMargin = current_sky.wallMargin
+	new_sky.wallFactor = current_sky.wallFactor
+	new_sky.species = current_sky.species
+	new_sky.neighborMode = current_sky.neighborMode
+	new_sky.numNeighbors = current_sky.numNeighbors
+	new_sky.vision = current_sky.vision
+	new_sky.model = current_sky.model
+	new_sky.maxForce = current_sky.maxForce
+	new_sky.noise = current_sky.noise
+	new_sky.integrator = current_sky.integrator
+	if current_sky.rules != nil {
+		new_sky.rules = append([]RuleSetting(nil), current_sky.rules...)
+	}
+	new_sky.obstacles = current_sky.obstacles
+	new_sky.avoidanceFactor = current_sky.avoidanceFactor
+	new_sky.avoidanceDistance = current_sky.avoidanceDistance
+	new_sky.maxPredatorSpeed = current_sky.maxPredatorSpeed
+	new_sky.pursuitFactor = current_sky.pursuitFactor
+	new_sky.fearRadius = current_sky.fearRadius
+	new_sky.fleeFactor = current_sky.fleeFactor
+	new_sky.catchRadius = current_sky.catchRadius
+	new_sky.captures = current_sky.captures
+	new_sky.rng = current_sky.rng
 	new_sky.boids = make([]Boid, len(current_sky.boids))
 	
 	for i := range current_sky.boids {
 		new_sky.boids[i] = CopyBoid(current_sky.boids[i])
 	}
 
+	if current_sky.predators != nil {
+		new_sky.predators = make([]Boid, len(current_sky.predators))
+		for i := range current_sky.predators {
+			new_sky.predators[i] = CopyBoid(current_sky.predators[i])
+		}
+	}
+
 	return new_sky
 }
 
 func CopyBoid(b Boid) Boid {
 	var new_boid Boid
 
+	new_boid.id = b.id
+	new_boid.species = b.species
+
 	new_boid.position.x = b.position.x 
 	new_boid.position.y = b.position.y
 
@@ -225,12 +441,14 @@ func CopyBoid(b Boid) Boid {
 }
 
 // Generate random sky with num_boids boids from input parameters
+// The same seed always produces the same sky; the sky keeps the random generator for later stochastic steps
 func GenerateRandomSky(num_boids int, 
-	sky_width, initial_speed, max_boid_speed, proximity, 
-	separation_factor, alignment_factor, cohesion_factor float64) Sky {
+	sky_width, sky_height, initial_speed, max_boid_speed, proximity, 
+	separation_factor, alignment_factor, cohesion_factor float64, seed int64) Sky {
 		var initial_sky Sky
 		
 		initial_sky.width = sky_width
+		initial_sky.height = sky_height
 		initial_sky.proximity = proximity
 		initial_sky.separationFactor = separation_factor
 		initial_sky.alignmentFactor = alignment_factor
@@ -238,14 +456,18 @@ func GenerateRandomSky(num_boids int,
 		initial_sky.maxBoidSpeed = max_boid_speed
 		initial_sky.boids = make([]Boid, num_boids)
 
-		rand.Seed(time.Now().UnixNano())
+		// per-simulation generator, so the global math/rand state is left untouched
+		rng := NewSeededRand(seed)
+		initial_sky.rng = rng
 
 		// for_, b := range ...: get copy of b thus can not change element in the slice, so deep copy is needed
 		for i := range initial_sky.boids {
-			initial_sky.boids[i].position.x = rand.Float64() * sky_width
-			initial_sky.boids[i].position.y = rand.Float64() * sky_width
+			initial_sky.boids[i].id = i
+
+			initial_sky.boids[i].position.x = rng.Float64() * sky_width
+			initial_sky.boids[i].position.y = rng.Float64() * sky_height
 
-			theta := rand.Float64() * 2.0 * math.Pi // random angle in [0, 2pi)
+			theta := rng.Float64() * 2.0 * math.Pi // random angle in [0, 2pi)
 			initial_sky.boids[i].velocity.x = initial_speed * math.Cos(theta)
 			initial_sky.boids[i].velocity.y = initial_speed * math.Sin(theta)
 
@@ -339,3 +339,233 @@ func ReadOrderedPairFromFile(file string) OrderedPair {
 
 	return OrderedPair{x: x, y: y}
 }
+
+// TestGenerateRandomSkySeed checks that the same seed reproduces the same initial sky bit for bit
+func TestGenerateRandomSkySeed(t *testing.T) {
+	sky_1 := GenerateRandomSky(50, 1000, 1000, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 42)
+	sky_2 := GenerateRandomSky(50, 1000, 1000, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 42)
+	sky_3 := GenerateRandomSky(50, 1000, 1000, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 43)
+
+	for i := range sky_1.boids {
+		if sky_1.boids[i] != sky_2.boids[i] {
+			t.Fatalf("GenerateRandomSky with seed 42 gave boid %d = %v and %v", i, sky_1.boids[i], sky_2.boids[i])
+		}
+	}
+
+	if sky_1.boids[0] == sky_3.boids[0] {
+		t.Errorf("GenerateRandomSky with seeds 42 and 43 gave the same first boid %v", sky_1.boids[0])
+	}
+}
+
+// TestUpdateSkyParallel checks that the parallel update is bitwise identical to the serial one
+func TestUpdateSkyParallel(t *testing.T) {
+	initial_sky := GenerateRandomSky(200, 1000, 600, 1.0, 2.0, 150, 1.5, 1.0, 0.02, 7)
+
+	for _, num_workers := range []int{1, 3, 8, 500} {
+		serial_sky, parallel_sky := initial_sky, initial_sky
+
+		for gen := 1; gen <= 20; gen++ {
+			var serial_err, parallel_err error
+			serial_sky, serial_err = UpdateSky(serial_sky, 1.0)
+			parallel_sky, parallel_err = UpdateSkyParallel(parallel_sky, 1.0, num_workers)
+			if serial_err != nil || parallel_err != nil {
+				t.Fatalf("generation %d: %v, %v", gen, serial_err, parallel_err)
+			}
+
+			for i := range serial_sky.boids {
+				if serial_sky.boids[i] != parallel_sky.boids[i] {
+					t.Fatalf("UpdateSkyParallel(workers: %d) generation %d boid %d = %v, want %v",
+						num_workers, gen, i, parallel_sky.boids[i], serial_sky.boids[i])
+				}
+			}
+		}
+	}
+}
+
+// ToroidalDistanceTest holds the information for a test of the ToroidalDistance function
+type ToroidalDistanceTest struct {
+	b1_pos     OrderedPair
+	b2_pos     OrderedPair
+	sky_width  float64
+	sky_height float64
+	result     float64
+}
+
+// TestToroidalDistance tests the ToroidalDistance function on pairs straddling each edge and corner of the sky
+func TestToroidalDistance(t *testing.T) {
+	tests := ReadToroidalDistanceTests("Tests/ToroidalDistance/")
+	for _, test := range tests {
+		result := ToroidalDistance(test.b1_pos, test.b2_pos, test.sky_width, test.sky_height)
+
+		epsilon := 1e-2 // tolerance for floating-point comparison
+
+		if math.Abs(result - test.result) > epsilon {
+			t.Errorf("ToroidalDistance(b1_pos: %v, b2_pos: %v, sky: %v x %v) = %v, want %v",
+				test.b1_pos, test.b2_pos, test.sky_width, test.sky_height, result, test.result)
+		}
+	}
+}
+
+// ReadToroidalDistanceTests takes as input a directory and returns a slice of ToroidalDistanceTest objects
+func ReadToroidalDistanceTests(directory string) []ToroidalDistanceTest {
+	input_files := ReadDirectory(directory + "/input")
+	num_files := len(input_files)
+
+	tests := make([]ToroidalDistanceTest, num_files)
+	for i, input_file := range input_files {
+		fields := ReadFloatFields(directory + "input/" + input_file.Name(), 6)
+		tests[i].b1_pos = OrderedPair{x: fields[0], y: fields[1]}
+		tests[i].b2_pos = OrderedPair{x: fields[2], y: fields[3]}
+		tests[i].sky_width = fields[4]
+		tests[i].sky_height = fields[5]
+	}
+
+	output_files := ReadDirectory(directory + "/output")
+	if len(output_files) != num_files {
+		panic("Error: number of input and output files do not match!")
+	}
+
+	for i, output_file := range output_files {
+		tests[i].result = ReadFloatFromFile(directory + "output/" + output_file.Name())
+	}
+
+	return tests
+}
+
+// ReadFloatFields reads the first data line of a file, which must contain exactly num_fields values
+func ReadFloatFields(file string, num_fields int) []float64 {
+	f, err := os.Open(file)
+	Check(err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		//skip comment lines
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != num_fields {
+			panic("Error: wrong number of values in " + file)
+		}
+
+		values := make([]float64, num_fields)
+		for i := range fields {
+			values[i], err = strconv.ParseFloat(fields[i], 64)
+			Check(err)
+		}
+
+		return values
+	}
+	panic("Error: no valid data line found")
+}
+
+// TestComputeNetForceWrap checks that two boids straddling an edge or corner of the sky
+// push and pull each other exactly as the same pair moved into the middle of the sky
+func TestComputeNetForceWrap(t *testing.T) {
+	sky_width := 100.0
+	tests := []struct {
+		name           string
+		b1_pos, b2_pos OrderedPair
+	}{
+		{"left edge", OrderedPair{x: 1, y: 50}, OrderedPair{x: 98, y: 52}},
+		{"right edge", OrderedPair{x: 99, y: 50}, OrderedPair{x: 2, y: 47}},
+		{"bottom edge", OrderedPair{x: 30, y: 0.5}, OrderedPair{x: 33, y: 96}},
+		{"top edge", OrderedPair{x: 30, y: 97}, OrderedPair{x: 28, y: 1}},
+		{"lower-left corner", OrderedPair{x: 1, y: 2}, OrderedPair{x: 97, y: 99}},
+		{"lower-right corner", OrderedPair{x: 99, y: 1}, OrderedPair{x: 3, y: 98}},
+		{"upper-left corner", OrderedPair{x: 2, y: 99}, OrderedPair{x: 98, y: 3}},
+		{"upper-right corner", OrderedPair{x: 98, y: 98}, OrderedPair{x: 1, y: 2}},
+	}
+
+	for _, test := range tests {
+		sky := Sky{width: sky_width, height: sky_width, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2}
+		sky.boids = []Boid{
+			{id: 0, position: test.b1_pos, velocity: OrderedPair{x: 1, y: 0}},
+			{id: 1, position: test.b2_pos, velocity: OrderedPair{x: 0, y: 1}},
+		}
+
+		// the same pair shifted by half a sky in both directions, away from every edge
+		shifted_sky := CopySky(sky)
+		for i := range shifted_sky.boids {
+			shifted_sky.boids[i].position.x = math.Mod(shifted_sky.boids[i].position.x + sky_width / 2, sky_width)
+			shifted_sky.boids[i].position.y = math.Mod(shifted_sky.boids[i].position.y + sky_width / 2, sky_width)
+		}
+
+		for _, with_grid := range []bool{false, true} {
+			if with_grid {
+				sky.grid = BuildSpatialGrid(sky)
+			}
+
+			result := ComputeNetForce(sky, sky.boids[0])
+			want := ComputeNetForce(shifted_sky, shifted_sky.boids[0])
+
+			if want == (OrderedPair{}) {
+				t.Fatalf("%s: the shifted pair does not interact", test.name)
+			}
+
+			epsilon := 1e-9
+			if math.Abs(result.x - want.x) > epsilon || math.Abs(result.y - want.y) > epsilon {
+				t.Errorf("ComputeNetForce(%s, grid: %v) = %v, want %v", test.name, with_grid, result, want)
+			}
+		}
+	}
+}
+
+// TestBoidIDs checks that every boid keeps its id through the generations
+func TestBoidIDs(t *testing.T) {
+	initial_sky := GenerateRandomSky(50, 800, 800, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 17)
+	time_points, err := SimulateBoids(initial_sky, 5, 1.0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for gen, sky := range time_points {
+		for i, b := range sky.boids {
+			if b.id != i {
+				t.Fatalf("generation %d: boid %d has id %d", gen, i, b.id)
+			}
+		}
+	}
+}
+
+// TestNeighborsSamePosition checks that two distinct boids at the same position each see the other and not themselves,
+// and that the rules, which have no direction to steer them by, give them no force
+func TestNeighborsSamePosition(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.02, maxBoidSpeed: 2}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+		{id: 1, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+	}
+
+	for _, b := range sky.boids {
+		neighbors := NeighborsInRange(sky, b)
+		if len(neighbors) != 1 || neighbors[0].Boid.id == b.id || neighbors[0].Distance != 0 {
+			t.Errorf("NeighborsInRange of boid %d = %+v, want only the other boid at distance 0", b.id, neighbors)
+		}
+		if force := ComputeNetForce(sky, b); force != (OrderedPair{}) {
+			t.Errorf("ComputeNetForce of boid %d at the same position as another = %v, want 0", b.id, force)
+		}
+	}
+}
+
+// UpdateSkyOrFail returns UpdateSkyParallel of current_sky, stopping the test if the step fails
+func UpdateSkyOrFail(t *testing.T, current_sky Sky, time_step float64, num_workers int) Sky {
+	t.Helper()
+
+	new_sky, err := UpdateSkyParallel(current_sky, time_step, num_workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return new_sky
+}
+
+// Check stops a test helper that cannot read its test data
+func Check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"io"
+	"os"
+)
+
+// GIFWriter encodes an animated GIF one frame at a time, so that frames can be written as soon as they are drawn
+// instead of being collected for gifhelper.ImagesToGIF. Frames use the same web-safe palette,
+// delay and loop count as gifhelper.
+type GIFWriter struct {
+	file          *os.File
+	w             *bufio.Writer
+	width, height int
+}
+
+const (
+	gifFrameDelay = 1     // hundredths of a second between frames
+	gifLoopCount  = 10    // number of times the animation repeats
+	gifMaxSize    = 65535 // largest width or height in pixels, as the GIF header stores them in 16 bits
+)
+
+// CheckGIFSize reports a width or height that a GIF cannot hold
+func CheckGIFSize(width, height int) error {
+	if width < 1 || width > gifMaxSize || height < 1 || height > gifMaxSize {
+		return fmt.Errorf("GIF of %d x %d pixels: width and height must be from 1 to %d", width, height, gifMaxSize)
+	}
+	return nil
+}
+
+// CreateGIF creates filename and writes the header of a width x height animated GIF to it.
+func CreateGIF(filename string, width, height int) (*GIFWriter, error) {
+	if err := CheckGIFSize(width, height); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GIFWriter{file: f, w: bufio.NewWriter(f), width: width, height: height}
+
+	// header and logical screen descriptor without a global color table
+	g.w.WriteString("GIF89a")
+	binary.Write(g.w, binary.LittleEndian, [2]uint16{uint16(width), uint16(height)})
+	g.w.Write([]byte{0x00, 0x00, 0x00})
+
+	// application extension making the animation loop
+	g.w.Write([]byte{0x21, 0xff, 0x0b})
+	g.w.WriteString("NETSCAPE2.0")
+	g.w.Write([]byte{0x03, 0x01, byte(gifLoopCount), byte(gifLoopCount >> 8), 0x00})
+
+	return g, nil
+}
+
+// OpenGIF reopens a GIF written by a GIFWriter to add more frames, discarding everything after its first size bytes.
+// size must be a value returned by Size, so that the file ends right after a frame.
+func OpenGIF(filename string, width, height int, size int64) (*GIFWriter, error) {
+	if err := CheckGIFSize(width, height); err != nil {
+		return nil, err
+	}
+
+	f, err := ReopenFile(filename, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GIFWriter{file: f, w: bufio.NewWriter(f), width: width, height: height}, nil
+}
+
+// Size returns the number of bytes written so far, which is where OpenGIF can continue the animation.
+func (g *GIFWriter) Size() (int64, error) {
+	if err := g.w.Flush(); err != nil {
+		return 0, err
+	}
+	return g.file.Seek(0, io.SeekCurrent)
+}
+
+// AddFrame appends img to the animation. The image is converted to the web-safe palette first.
+func (g *GIFWriter) AddFrame(img image.Image) error {
+	pm := image.NewPaletted(image.Rect(0, 0, g.width, g.height), palette.WebSafe)
+	draw.Draw(pm, pm.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	// graphic control extension with the frame delay
+	g.w.Write([]byte{0x21, 0xf9, 0x04, 0x00, byte(gifFrameDelay), byte(gifFrameDelay >> 8), 0x00, 0x00})
+
+	// image descriptor with a 256-entry local color table
+	g.w.WriteByte(0x2c)
+	binary.Write(g.w, binary.LittleEndian, [4]uint16{0, 0, uint16(g.width), uint16(g.height)})
+	g.w.WriteByte(0x87)
+
+	var color_table [256 * 3]byte
+	for i, c := range palette.WebSafe {
+		r, gr, b, _ := c.RGBA()
+		color_table[3*i], color_table[3*i+1], color_table[3*i+2] = byte(r>>8), byte(gr>>8), byte(b>>8)
+	}
+	g.w.Write(color_table[:])
+
+	// LZW-compressed pixels, split into data sub-blocks of at most 255 bytes
+	const lit_width = 8
+	g.w.WriteByte(lit_width)
+	blocks := &gifBlockWriter{w: g.w}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, lit_width)
+	if _, err := compressor.Write(pm.Pix); err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	if err := blocks.Close(); err != nil {
+		return err
+	}
+
+	return g.w.Flush()
+}
+
+// Close writes the GIF trailer and closes the file.
+func (g *GIFWriter) Close() error {
+	g.w.WriteByte(0x3b)
+	if err := g.w.Flush(); err != nil {
+		g.file.Close()
+		return err
+	}
+
+	return g.file.Close()
+}
+
+// gifBlockWriter splits a byte stream into the length-prefixed sub-blocks of GIF image data.
+type gifBlockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	for i := range p {
+		b.buf[b.n] = p[i]
+		b.n++
+		if b.n == len(b.buf) {
+			if err := b.flush(); err != nil {
+				return i, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+
+	b.w.WriteByte(byte(b.n))
+	_, err := b.w.Write(b.buf[:b.n])
+	b.n = 0
+
+	return err
+}
+
+// Close writes the last sub-block and the block terminator.
+func (b *gifBlockWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+
+	return b.w.WriteByte(0x00)
+}
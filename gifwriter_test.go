@@ -0,0 +1,71 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGIFWriter writes a few frames and checks that image/gif decodes them back
+func TestGIFWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "frames.gif")
+	colors := []color.RGBA{{255, 255, 255, 255}, {0, 0, 0, 255}, {0, 102, 204, 255}}
+	width, height := 40, 30
+
+	g, err := CreateGIF(filename, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		// one differently colored pixel, to check the orientation of the frame
+		img.Set(width-1, 0, color.RGBA{255, 0, 0, 255})
+
+		if err := g.AddFrame(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreateGIF(filepath.Join(t.TempDir(), "wide.gif"), 70000, 10); err == nil {
+		t.Errorf("CreateGIF accepted a width of 70000 pixels")
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	animation, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("gif.DecodeAll: %v", err)
+	}
+
+	if len(animation.Image) != len(colors) || animation.LoopCount != gifLoopCount {
+		t.Fatalf("decoded %d frames with loop count %d, want %d frames with loop count %d",
+			len(animation.Image), animation.LoopCount, len(colors), gifLoopCount)
+	}
+
+	for i, frame := range animation.Image {
+		r, g, b, _ := frame.At(0, height-1).RGBA()
+		if r>>8 != uint32(colors[i].R) || g>>8 != uint32(colors[i].G) || b>>8 != uint32(colors[i].B) {
+			t.Errorf("frame %d has color (%d, %d, %d), want %v", i, r>>8, g>>8, b>>8, colors[i])
+		}
+
+		r, g, b, _ = frame.At(width-1, 0).RGBA()
+		if r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+			t.Errorf("frame %d corner has color (%d, %d, %d), want red", i, r>>8, g>>8, b>>8)
+		}
+	}
+}
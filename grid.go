@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// SpatialGrid buckets the boids of one Sky into cells that are at least proximity wide and high.
+// Every boid closer than proximity to a point then lies in the point's own cell or one of the eight cells around it,
+// so ComputeNetForce only needs to look at those cells instead of the whole sky.
+// On a wrapping sky the cells tile the sky exactly and the block of cells wraps around the edges;
+// otherwise the cells cover the bounding box of the boids.
+type SpatialGrid struct {
+	origin                OrderedPair // lower-left corner of cell (0, 0)
+	cellWidth, cellHeight float64
+	cols, rows            int
+	wrap                  bool
+	cellStart             []int // boids of cell c are indices[cellStart[c]:cellStart[c+1]]
+	indices               []int // boid indices sorted by cell, ascending within each cell
+}
+
+// BuildSpatialGrid indexes the boids of current_sky by position.
+// The cells are as small as proximity allows, but there are never many more cells than boids.
+func BuildSpatialGrid(current_sky Sky) *SpatialGrid {
+	var grid SpatialGrid
+	num_boids := len(current_sky.boids)
+	max_cells := 4*num_boids + 16
+
+	if current_sky.boundary == WrapBoundary {
+		grid.wrap = true
+		grid.cols, grid.rows = 1, 1
+		if current_sky.proximity > 0 {
+			grid.cols = max(1, int(current_sky.width/current_sky.proximity))
+			grid.rows = max(1, int(current_sky.height/current_sky.proximity))
+		}
+		// merge neighboring cells until there are not too many of them
+		for grid.cols*grid.rows > max_cells {
+			grid.cols = (grid.cols + 1) / 2
+			grid.rows = (grid.rows + 1) / 2
+		}
+		grid.cellWidth = current_sky.width / float64(grid.cols)
+		grid.cellHeight = current_sky.height / float64(grid.rows)
+	} else {
+		min_pos, max_pos := BoundingBox(current_sky.boids)
+		span_x := max_pos.x - min_pos.x
+		span_y := max_pos.y - min_pos.y
+
+		grid.origin = min_pos
+		cell_size := current_sky.proximity
+		if cell_size <= 0 {
+			cell_size = math.Max(math.Max(span_x, span_y), 1.0)
+		}
+
+		// counted in floats, so that boids flung far apart cannot overflow the number of cells
+		for {
+			cols := math.Floor(span_x/cell_size) + 1
+			rows := math.Floor(span_y/cell_size) + 1
+			if cols*rows <= float64(max_cells) {
+				grid.cols, grid.rows = int(cols), int(rows)
+				break
+			}
+			if math.IsInf(cell_size, 0) {
+				// boids spread beyond the range of float64: one cell holds them all
+				grid.cols, grid.rows = 1, 1
+				break
+			}
+			cell_size *= 2
+		}
+		grid.cellWidth, grid.cellHeight = cell_size, cell_size
+	}
+
+	// counting sort of the boids by cell; boids are visited in index order, so each cell stays ascending
+	cells := make([]int, num_boids)
+	grid.cellStart = make([]int, grid.cols*grid.rows+1)
+	for i, b := range current_sky.boids {
+		col, row := CellColumnRow(&grid, b.position)
+		cells[i] = CellIndex(&grid, col, row)
+		grid.cellStart[cells[i]+1]++
+	}
+
+	for c := 1; c < len(grid.cellStart); c++ {
+		grid.cellStart[c] += grid.cellStart[c-1]
+	}
+
+	grid.indices = make([]int, num_boids)
+	next := make([]int, grid.cols*grid.rows)
+	copy(next, grid.cellStart)
+	for i, c := range cells {
+		grid.indices[next[c]] = i
+		next[c]++
+	}
+
+	return &grid
+}
+
+// BoundingBox returns the smallest and largest coordinates of the boids' positions
+func BoundingBox(boids []Boid) (OrderedPair, OrderedPair) {
+	min_pos := OrderedPair{x: math.Inf(1), y: math.Inf(1)}
+	max_pos := OrderedPair{x: math.Inf(-1), y: math.Inf(-1)}
+
+	for _, b := range boids {
+		// a boid that blew up has no place in the box; StreamBoids reports it
+		if math.IsNaN(b.position.x) || math.IsInf(b.position.x, 0) || math.IsNaN(b.position.y) || math.IsInf(b.position.y, 0) {
+			continue
+		}
+		min_pos.x = math.Min(min_pos.x, b.position.x)
+		min_pos.y = math.Min(min_pos.y, b.position.y)
+		max_pos.x = math.Max(max_pos.x, b.position.x)
+		max_pos.y = math.Max(max_pos.y, b.position.y)
+	}
+
+	if min_pos.x > max_pos.x {
+		return OrderedPair{}, OrderedPair{}
+	}
+
+	return min_pos, max_pos
+}
+
+// CellColumnRow returns the column and row of the cell containing pos, before they are wrapped or clamped onto the grid
+func CellColumnRow(grid *SpatialGrid, pos OrderedPair) (int, int) {
+	col := math.Floor((pos.x - grid.origin.x) / grid.cellWidth)
+	row := math.Floor((pos.y - grid.origin.y) / grid.cellHeight)
+
+	// keep far-away points from overflowing the conversion to int
+	limit := float64(grid.cols + grid.rows + 1)
+	col = math.Max(-limit, math.Min(col, limit))
+	row = math.Max(-limit, math.Min(row, limit))
+
+	return int(col), int(row)
+}
+
+// CellIndex returns the index of the cell in column col and row row, wrapped or clamped onto the grid
+func CellIndex(grid *SpatialGrid, col, row int) int {
+	if grid.wrap {
+		col = ((col % grid.cols) + grid.cols) % grid.cols
+		row = ((row % grid.rows) + grid.rows) % grid.rows
+	} else {
+		col = max(0, min(col, grid.cols-1))
+		row = max(0, min(row, grid.rows-1))
+	}
+
+	return row*grid.cols + col
+}
+
+// NeighborCandidates returns, in ascending order, the indices of every boid in current_sky that may lie within proximity of pos.
+// Without a grid every boid is a candidate. Keeping the brute-force order means the forces are summed
+// in the same order either way, so the grid does not change the results.
+func NeighborCandidates(current_sky Sky, pos OrderedPair) []int {
+	grid := current_sky.grid
+
+	if grid == nil {
+		candidates := make([]int, len(current_sky.boids))
+		for i := range candidates {
+			candidates[i] = i
+		}
+		return candidates
+	}
+
+	// the cells overlapping the square of side 2*proximity around pos; since cells are at least
+	// proximity wide this is at most the 3x3 block around pos. The radius is padded slightly
+	// so that rounding in the cell size can never drop a boid across a wrapped edge.
+	radius := current_sky.proximity + 1e-9*math.Max(current_sky.width, current_sky.height)
+	if radius <= 0 {
+		return nil
+	}
+	col_lo, row_lo := CellColumnRow(grid, OrderedPair{x: pos.x - radius, y: pos.y - radius})
+	col_hi, row_hi := CellColumnRow(grid, OrderedPair{x: pos.x + radius, y: pos.y + radius})
+
+	if grid.wrap {
+		// on small grids the block wraps onto itself; visit each cell only once
+		col_hi = min(col_hi, col_lo+grid.cols-1)
+		row_hi = min(row_hi, row_lo+grid.rows-1)
+	} else {
+		col_lo, row_lo = max(col_lo, 0), max(row_lo, 0)
+		col_hi, row_hi = min(col_hi, grid.cols-1), min(row_hi, grid.rows-1)
+	}
+
+	var candidates []int
+	for r := row_lo; r <= row_hi; r++ {
+		for c := col_lo; c <= col_hi; c++ {
+			cell := CellIndex(grid, c, r)
+			candidates = append(candidates, grid.indices[grid.cellStart[cell]:grid.cellStart[cell+1]]...)
+		}
+	}
+
+	sort.Ints(candidates)
+
+	return candidates
+}
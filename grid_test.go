@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestSpatialGridMatchesBruteForce checks that the forces computed with the spatial grid
+// are identical to the brute-force forces, for dense, sparse and degenerate skies
+func TestSpatialGridMatchesBruteForce(t *testing.T) {
+	tests := []struct {
+		num_boids            int
+		sky_width, proximity float64
+	}{
+		{300, 1000, 100},
+		{300, 1000, 7},    // many tiny cells, the cell size has to grow
+		{300, 1000, 5000}, // proximity wider than the sky
+		{50, 1000, 0},
+		{1, 1000, 100},
+	}
+
+	for seed, test := range tests {
+		for _, boundary := range []BoundaryMode{WrapBoundary, OpenBoundary} {
+			sky := GenerateRandomSky(test.num_boids, test.sky_width, test.sky_width/2, 1.0, 2.0, test.proximity, 1.5, 1.0, 0.02, int64(seed))
+			sky.boundary = boundary
+			// boids on the sky edge and on top of each other
+			if test.num_boids > 3 {
+				sky.boids[0].position = OrderedPair{x: test.sky_width, y: test.sky_width / 2}
+				sky.boids[1].position = OrderedPair{x: 0, y: test.sky_width / 2}
+				sky.boids[2].position = sky.boids[3].position
+			}
+			// a straggler far outside the sky
+			if boundary == OpenBoundary {
+				sky.boids[0].position = OrderedPair{x: -40 * test.sky_width, y: 3 * test.sky_width}
+			}
+
+			indexed_sky := sky
+			indexed_sky.grid = BuildSpatialGrid(sky)
+
+			for i, b := range sky.boids {
+				want := ComputeNetForce(sky, b)
+				result := ComputeNetForce(indexed_sky, b)
+
+				if result != want {
+					t.Errorf("ComputeNetForce with grid (boids: %d, proximity: %v, boundary: %v) for boid %d = %v, want %v",
+						test.num_boids, test.proximity, boundary, i, result, want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkNetForce times one generation of force computations at a constant boid density
+// (about ten neighbors per boid), with and without the spatial grid.
+func BenchmarkNetForce(b *testing.B) {
+	proximity := 50.0
+	area_per_boid := math.Pi * proximity * proximity / 10
+
+	for _, num_boids := range []int{1000, 10000, 100000} {
+		sky_width := math.Sqrt(float64(num_boids) * area_per_boid)
+		sky := GenerateRandomSky(num_boids, sky_width, sky_width, 1.0, 2.0, proximity, 1.5, 1.0, 0.02, 1)
+
+		b.Run(fmt.Sprintf("grid/boids=%d", num_boids), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				indexed_sky := sky
+				indexed_sky.grid = BuildSpatialGrid(sky)
+				for i := range indexed_sky.boids {
+					UpdateAcceleration(indexed_sky, i)
+				}
+			}
+		})
+
+		// the brute-force search is quadratic, 100000 boids would take minutes per generation
+		if num_boids > 10000 {
+			continue
+		}
+
+		b.Run(fmt.Sprintf("brute/boids=%d", num_boids), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for i := range sky.boids {
+					UpdateAcceleration(sky, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+var integrationSchemeNames = []string{
+	LegacyScheme:       "legacy",
+	EulerScheme:        "euler",
+	SemiImplicitScheme: "semi-implicit",
+	VerletScheme:       "verlet",
+	RK4Scheme:          "rk4",
+}
+
+// String returns the name of the integration scheme used in flags and run files
+func (scheme IntegrationScheme) String() string {
+	if scheme < 0 || int(scheme) >= len(integrationSchemeNames) {
+		return fmt.Sprintf("IntegrationScheme(%d)", int(scheme))
+	}
+	return integrationSchemeNames[scheme]
+}
+
+// MarshalText writes the integration scheme by name, so that run files read "integrator": "rk4"
+func (scheme IntegrationScheme) MarshalText() ([]byte, error) {
+	return []byte(scheme.String()), nil
+}
+
+// UnmarshalText reads an integration scheme by name
+func (scheme *IntegrationScheme) UnmarshalText(text []byte) error {
+	for s, name := range integrationSchemeNames {
+		if string(text) == name {
+			*scheme = IntegrationScheme(s)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown integrator %q (want legacy, euler, semi-implicit, verlet or rk4)", text)
+}
+
+// Accelerations returns the acceleration of every boid of boids. start is true only when boids are the boids given to Step,
+// unchanged, so that what is already known of them (such as the spatial grid of the sky) can be reused;
+// every evaluation at trial positions and velocities within the step passes false.
+type Accelerations func(boids []Boid, start bool) []OrderedPair
+
+// Integrator moves the boids forward by one time step. accelerations returns the acceleration of every boid
+// for trial positions and velocities of all the boids, so an integrator may evaluate the forces several times per step.
+// Step returns new boids with their positions, velocities and the acceleration kept for the next step,
+// and leaves boids unchanged. The new velocity of boid b is kept under max_speed(b), and so is the velocity
+// with which the new schemes move positions, so a boid never moves farther than max_speed(b) * time_step;
+// the edges of the sky and the obstacles are applied afterwards.
+type Integrator interface {
+	Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid
+}
+
+// SkyIntegrator returns the integrator of the scheme of current_sky
+func SkyIntegrator(current_sky Sky) Integrator {
+	switch current_sky.integrator {
+	case EulerScheme:
+		return EulerIntegrator{}
+	case SemiImplicitScheme:
+		return SemiImplicitIntegrator{}
+	case VerletScheme:
+		return VerletIntegrator{}
+	case RK4Scheme:
+		return RK4Integrator{}
+	default:
+		return LegacyIntegrator{}
+	}
+}
+
+// LegacyIntegrator is the original scheme of UpdateVelocity and UpdatePosition: one force evaluation per step,
+// the position moved with the old velocity and the acceleration of the previous step,
+// and the velocity with the mean of the previous and the new acceleration.
+// Unlike the other schemes, the half step of the old acceleration may carry a boid a little past max_speed * time_step.
+type LegacyIntegrator struct{}
+
+// Step moves the boids by one legacy step
+func (LegacyIntegrator) Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid {
+	new_boids := append([]Boid(nil), boids...)
+	new_accelerations := accelerations(boids, true)
+
+	for i, b := range boids {
+		new_boids[i].acceleration = new_accelerations[i]
+		new_boids[i].velocity = UpdateVelocity(new_boids[i], b.acceleration, max_speed(b), time_step)
+		new_boids[i].position = UpdatePosition(new_boids[i], b.acceleration, b.velocity, time_step)
+	}
+
+	return new_boids
+}
+
+// EulerIntegrator is the explicit Euler scheme: position and velocity both move with their rates at the start of the step
+type EulerIntegrator struct{}
+
+// Step moves the boids by one explicit Euler step
+func (EulerIntegrator) Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid {
+	a := accelerations(boids, true)
+	new_boids := ShiftBoids(boids, LimitSpeeds(boids, Velocities(boids), max_speed), a, time_step)
+
+	for i := range new_boids {
+		new_boids[i].acceleration = a[i]
+		new_boids[i].velocity = LimitSpeed(new_boids[i].velocity, max_speed(boids[i]))
+	}
+
+	return new_boids
+}
+
+// SemiImplicitIntegrator is the semi-implicit (symplectic) Euler scheme: the velocity moves first,
+// and the position moves with the new velocity
+type SemiImplicitIntegrator struct{}
+
+// Step moves the boids by one semi-implicit Euler step
+func (SemiImplicitIntegrator) Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid {
+	a := accelerations(boids, true)
+	new_boids := append([]Boid(nil), boids...)
+
+	for i := range new_boids {
+		new_boids[i].acceleration = a[i]
+		new_boids[i].velocity.x += a[i].x * time_step
+		new_boids[i].velocity.y += a[i].y * time_step
+		new_boids[i].velocity = LimitSpeed(new_boids[i].velocity, max_speed(boids[i]))
+		new_boids[i].position.x += new_boids[i].velocity.x * time_step
+		new_boids[i].position.y += new_boids[i].velocity.y * time_step
+	}
+
+	return new_boids
+}
+
+// VerletIntegrator is the velocity Verlet scheme, with the accelerations at the start and at the end of the step
+// both evaluated in the step. As the forces depend on velocities, the end acceleration uses the velocities predicted by Euler.
+type VerletIntegrator struct{}
+
+// Step moves the boids by one velocity Verlet step
+func (VerletIntegrator) Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid {
+	a0 := accelerations(boids, true)
+
+	// the position moves with the velocity at the middle of the step, v + a0 dt/2
+	middle := Velocities(boids)
+	for i := range middle {
+		middle[i].x += 0.5 * a0[i].x * time_step
+		middle[i].y += 0.5 * a0[i].y * time_step
+	}
+	predicted := ShiftBoids(boids, LimitSpeeds(boids, middle, max_speed), a0, time_step)
+	a1 := accelerations(predicted, false)
+
+	new_boids := predicted
+	for i, b := range boids {
+		new_boids[i].velocity.x = b.velocity.x + 0.5*(a0[i].x+a1[i].x)*time_step
+		new_boids[i].velocity.y = b.velocity.y + 0.5*(a0[i].y+a1[i].y)*time_step
+		new_boids[i].velocity = LimitSpeed(new_boids[i].velocity, max_speed(b))
+		new_boids[i].acceleration = a1[i]
+	}
+
+	return new_boids
+}
+
+// RK4Integrator is the classic fourth-order Runge-Kutta scheme on the positions and velocities of all the boids,
+// with four force evaluations per step
+type RK4Integrator struct{}
+
+// Step moves the boids by one Runge-Kutta step
+func (RK4Integrator) Step(boids []Boid, accelerations Accelerations, max_speed func(b Boid) float64, time_step float64) []Boid {
+	half := time_step / 2
+
+	v1, a1 := Velocities(boids), accelerations(boids, true)
+	s2 := ShiftBoids(boids, v1, a1, half)
+	v2, a2 := Velocities(s2), accelerations(s2, false)
+	s3 := ShiftBoids(boids, v2, a2, half)
+	v3, a3 := Velocities(s3), accelerations(s3, false)
+	s4 := ShiftBoids(boids, v3, a3, time_step)
+	v4, a4 := Velocities(s4), accelerations(s4, false)
+
+	new_boids := append([]Boid(nil), boids...)
+	for i, b := range boids {
+		// the mean velocity of the step, kept under the speed limit
+		mean := LimitSpeed(OrderedPair{x: (v1[i].x + 2*v2[i].x + 2*v3[i].x + v4[i].x) / 6, y: (v1[i].y + 2*v2[i].y + 2*v3[i].y + v4[i].y) / 6}, max_speed(b))
+		new_boids[i].position.x += time_step * mean.x
+		new_boids[i].position.y += time_step * mean.y
+		new_boids[i].velocity.x += time_step / 6 * (a1[i].x + 2*a2[i].x + 2*a3[i].x + a4[i].x)
+		new_boids[i].velocity.y += time_step / 6 * (a1[i].y + 2*a2[i].y + 2*a3[i].y + a4[i].y)
+		new_boids[i].velocity = LimitSpeed(new_boids[i].velocity, max_speed(b))
+		new_boids[i].acceleration = a1[i]
+	}
+
+	return new_boids
+}
+
+// Velocities returns the velocity of every boid
+func Velocities(boids []Boid) []OrderedPair {
+	velocities := make([]OrderedPair, len(boids))
+	for i, b := range boids {
+		velocities[i] = b.velocity
+	}
+	return velocities
+}
+
+// ShiftBoids returns copies of boids with every position moved by h times its rate in d_position,
+// and every velocity by h times its rate in d_velocity
+func ShiftBoids(boids []Boid, d_position, d_velocity []OrderedPair, h float64) []Boid {
+	shifted := append([]Boid(nil), boids...)
+
+	for i := range shifted {
+		shifted[i].position.x += h * d_position[i].x
+		shifted[i].position.y += h * d_position[i].y
+		shifted[i].velocity.x += h * d_velocity[i].x
+		shifted[i].velocity.y += h * d_velocity[i].y
+	}
+
+	return shifted
+}
+
+// LimitSpeeds returns velocities, each kept under the max_speed of the boid with the same index
+func LimitSpeeds(boids []Boid, velocities []OrderedPair, max_speed func(b Boid) float64) []OrderedPair {
+	limited := make([]OrderedPair, len(velocities))
+	for i, v := range velocities {
+		limited[i] = LimitSpeed(v, max_speed(boids[i]))
+	}
+	return limited
+}
+
+// LimitSpeed scales velocity down to max_speed if it is faster, like UpdateVelocity
+func LimitSpeed(velocity OrderedPair, max_speed float64) OrderedPair {
+	speed := math.Sqrt(velocity.x*velocity.x + velocity.y*velocity.y)
+
+	if speed > max_speed {
+		velocity.x = velocity.x * (max_speed / speed)
+		velocity.y = velocity.y * (max_speed / speed)
+	}
+
+	return velocity
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// integratorOrders are the orders of accuracy of the integrators: halving the time step divides their global error by 2^order
+var integratorOrders = []struct {
+	scheme IntegrationScheme
+	order  float64
+}{
+	{EulerScheme, 1},
+	{SemiImplicitScheme, 1},
+	{VerletScheme, 2},
+	{RK4Scheme, 4},
+}
+
+// TestIntegrationSchemeText checks that integrators are read and written by name
+func TestIntegrationSchemeText(t *testing.T) {
+	for _, scheme := range []IntegrationScheme{LegacyScheme, EulerScheme, SemiImplicitScheme, VerletScheme, RK4Scheme} {
+		text, _ := scheme.MarshalText()
+		var result IntegrationScheme
+		if err := result.UnmarshalText(text); err != nil || result != scheme {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, result, err, scheme)
+		}
+	}
+
+	var scheme IntegrationScheme
+	if err := scheme.UnmarshalText([]byte("leapfrog")); err == nil {
+		t.Errorf("UnmarshalText accepted an unknown integrator")
+	}
+}
+
+// TestIntegratorsConstantForce checks each integrator against the exact path of a boid under a constant force,
+// x = x0 + v0 t + a t²/2: Verlet and RK4 follow it exactly, and the error of the Euler schemes shrinks with the time step
+func TestIntegratorsConstantForce(t *testing.T) {
+	x0, v0, a := OrderedPair{x: 1, y: 2}, OrderedPair{x: 3, y: -1}, OrderedPair{x: 0.5, y: -2}
+	constant := func(boids []Boid, start bool) []OrderedPair {
+		accelerations := make([]OrderedPair, len(boids))
+		for i := range accelerations {
+			accelerations[i] = a
+		}
+		return accelerations
+	}
+	unlimited := func(b Boid) float64 { return math.Inf(1) }
+
+	duration := 8.0
+	final_error := func(scheme IntegrationScheme, time_step float64) float64 {
+		boids := []Boid{{position: x0, velocity: v0, acceleration: a}}
+		for step := 0; step < int(math.Round(duration/time_step)); step++ {
+			boids = SkyIntegrator(Sky{integrator: scheme}).Step(boids, constant, unlimited, time_step)
+		}
+		want := OrderedPair{x: x0.x + v0.x*duration + a.x*duration*duration/2, y: x0.y + v0.y*duration + a.y*duration*duration/2}
+		return Distance(boids[0].position, want)
+	}
+
+	// the legacy scheme is exact too, once the acceleration of the previous step is the constant one
+	for _, scheme := range []IntegrationScheme{LegacyScheme, VerletScheme, RK4Scheme} {
+		if err := final_error(scheme, 0.5); err > 1e-9 {
+			t.Errorf("%v integrator under a constant force is %v away from the exact path", scheme, err)
+		}
+	}
+
+	for _, scheme := range []IntegrationScheme{EulerScheme, SemiImplicitScheme} {
+		coarse, fine := final_error(scheme, 0.5), final_error(scheme, 0.25)
+		if ratio := coarse / fine; math.Abs(ratio-2) > 0.1 {
+			t.Errorf("%v integrator under a constant force: error %v at time step 0.5 and %v at 0.25, want a ratio of 2", scheme, coarse, fine)
+		}
+	}
+}
+
+// TestIntegratorsStart checks that every integrator evaluates the forces once on the boids at the start of the step
+// with start true, and on every trial state with start false
+func TestIntegratorsStart(t *testing.T) {
+	boids := []Boid{{id: 0, position: OrderedPair{x: 1, y: 2}, velocity: OrderedPair{x: 3, y: -1}}, {id: 1, position: OrderedPair{x: 5, y: 5}}}
+	unlimited := func(b Boid) float64 { return math.Inf(1) }
+
+	for _, scheme := range []IntegrationScheme{LegacyScheme, EulerScheme, SemiImplicitScheme, VerletScheme, RK4Scheme} {
+		starts := 0
+		pull := func(trial []Boid, start bool) []OrderedPair {
+			if start {
+				starts++
+				if !reflect.DeepEqual(trial, boids) {
+					t.Errorf("%v integrator: start evaluation on %v, want the boids given to Step %v", scheme, trial, boids)
+				}
+			} else if reflect.DeepEqual(trial, boids) {
+				t.Errorf("%v integrator: trial evaluation on the unchanged boids", scheme)
+			}
+			accelerations := make([]OrderedPair, len(trial))
+			for i := range accelerations {
+				accelerations[i] = OrderedPair{x: 0.5, y: -2}
+			}
+			return accelerations
+		}
+
+		SkyIntegrator(Sky{integrator: scheme}).Step(boids, pull, unlimited, 0.5)
+		if starts != 1 {
+			t.Errorf("%v integrator evaluated the forces at the start of the step %d times, want once", scheme, starts)
+		}
+	}
+}
+
+// TwoBodySeparation returns the distance at time t between two boids that start at rest r0 apart
+// and push each other away by separation alone. Each boid accelerates at S/r, so d²r/dt² = 2S/r and (dr/dt)² = 4S ln(r/r0),
+// which gives t = r0/√S ∫₀ᵘ exp(w²) dw with u = √ln(r/r0), solved here for r.
+func TwoBodySeparation(r0, S, t float64) float64 {
+	// ∫₀ᵘ exp(w²) dw = Σ u^(2n+1) / (n! (2n+1))
+	integral := func(u float64) float64 {
+		sum, term := 0.0, u
+		for n := 0; n < 200; n++ {
+			sum += term / float64(2*n+1)
+			term *= u * u / float64(n+1)
+		}
+		return sum
+	}
+
+	low, high := 0.0, 10.0
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if r0/math.Sqrt(S)*integral(mid) < t {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	u := (low + high) / 2
+
+	return r0 * math.Exp(u*u)
+}
+
+// TestIntegratorsTwoBodySeparation runs two boids pushing each other apart through the whole update of the sky,
+// and checks that the error of each integrator against TwoBodySeparation falls with the time step at the order of the integrator
+func TestIntegratorsTwoBodySeparation(t *testing.T) {
+	r0, S, duration := 10.0, 1.0, 20.0
+
+	final_error := func(scheme IntegrationScheme, time_step float64) float64 {
+		sky := Sky{width: 1000, height: 1000, proximity: 200, separationFactor: S, maxBoidSpeed: 100, integrator: scheme}
+		sky.boids = []Boid{
+			{id: 0, position: OrderedPair{x: 500 - r0/2, y: 500}},
+			{id: 1, position: OrderedPair{x: 500 + r0/2, y: 500}},
+		}
+		for step := 0; step < int(math.Round(duration/time_step)); step++ {
+			sky = UpdateSkyOrFail(t, sky, time_step, 1)
+		}
+		return math.Abs(Distance(sky.boids[0].position, sky.boids[1].position) - TwoBodySeparation(r0, S, duration))
+	}
+
+	for _, integrator := range integratorOrders {
+		errors := []float64{final_error(integrator.scheme, 0.4), final_error(integrator.scheme, 0.2), final_error(integrator.scheme, 0.1)}
+
+		for k := 1; k < len(errors); k++ {
+			// observed order from one halving of the time step
+			order := math.Log2(errors[k-1] / errors[k])
+			if math.Abs(order-integrator.order) > 0.35 {
+				t.Errorf("%v integrator: errors %v for time steps 0.4, 0.2 and 0.1 converge at order %.2f, want %v",
+					integrator.scheme, errors, order, integrator.order)
+				break
+			}
+		}
+	}
+}
+
+// TestIntegratorsSpeedLimit checks that no integrator other than the legacy one moves a boid farther than
+// maxBoidSpeed * timeStep in one step, or a predator farther than maxPredatorSpeed * timeStep, however strong the forces
+func TestIntegratorsSpeedLimit(t *testing.T) {
+	for _, integrator := range integratorOrders {
+		sky := GenerateRandomSky(100, 300, 300, 1.0, 2.0, 60, 50, 10, 5, 4)
+		sky = AddPredators(sky, 3, 1.0)
+		sky.maxPredatorSpeed, sky.pursuitFactor = 3, 20
+		sky.integrator = integrator.scheme
+
+		for gen := 1; gen <= 20; gen++ {
+			new_sky := UpdateSkyOrFail(t, sky, 1.5, 1)
+			for i, b := range new_sky.boids {
+				moved := ToroidalDistance(sky.boids[i].position, b.position, sky.width, sky.height)
+				if speed := math.Hypot(b.velocity.x, b.velocity.y); moved > 2*1.5+1e-9 || speed > 2+1e-12 {
+					t.Fatalf("%v integrator, generation %d: boid %d moved %v at speed %v, want at most %v at speed 2",
+						integrator.scheme, gen, b.id, moved, speed, 2*1.5)
+				}
+			}
+			for i, p := range new_sky.predators {
+				moved := ToroidalDistance(sky.predators[i].position, p.position, sky.width, sky.height)
+				if speed := math.Hypot(p.velocity.x, p.velocity.y); moved > 3*1.5+1e-9 || speed > 3+1e-12 {
+					t.Fatalf("%v integrator, generation %d: predator %d moved %v at speed %v, want at most %v at speed 3",
+						integrator.scheme, gen, p.id, moved, speed, 3*1.5)
+				}
+			}
+			sky = new_sky
+		}
+	}
+}
+
+// TestIntegratorsParallel checks that every integrator gives the same sky in parallel as serially
+func TestIntegratorsParallel(t *testing.T) {
+	for _, integrator := range integratorOrders {
+		sky := GenerateRandomSky(200, 500, 500, 1.0, 2.0, 60, 1.5, 1.0, 0.02, 3)
+		sky.integrator = integrator.scheme
+
+		serial_sky, parallel_sky := sky, sky
+		for gen := 1; gen <= 20; gen++ {
+			serial_sky = UpdateSkyOrFail(t, serial_sky, 1.0, 1)
+			parallel_sky = UpdateSkyOrFail(t, parallel_sky, 1.0, 4)
+		}
+
+		for i := range serial_sky.boids {
+			if serial_sky.boids[i] != parallel_sky.boids[i] {
+				t.Fatalf("%v integrator: UpdateSkyParallel boid %d = %v, want %v", integrator.scheme, i, parallel_sky.boids[i], serial_sky.boids[i])
+			}
+		}
+	}
+}
@@ -1,100 +1,297 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"gifhelper"
+	"path/filepath"
+	"time"
 )
 
 func main() {
 	fmt.Println("Hacking boids!")
 
-	// Process your command-line arguments here
-	if len(os.Args) != 13 {
-		panic("Error: incorrect number of command line arguments.")
+	// errors are reported instead of panicking; invalid parameters exit with status 2, failed runs with status 1
+	if err := Run(os.Args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(ExitCode(err))
 	}
+}
 
-	// take CLAs
-	// ./boids numBoids skyWidth initialSpeed maxBoidSpeed numGens proximity separationFactor
-	// alignmentFactor cohesionFactor timeStep canvasWidth imageFrequency
+// Run executes the command line args (without the program name): a new run, "resume" or "sweep"
+func Run(args []string) error {
+	// ./boids resume continues a run from its last checkpoint
+	if len(args) > 0 && args[0] == "resume" {
+		return Resume(args[1:])
+	}
 
-	// than initial_sky will be generated with these parameters
-	num_boids, err_1 := strconv.Atoi(os.Args[1])
-	Check(err_1)
+	// ./boids sweep -vary separationFactor=0:3:7 ... simulates every combination of parameter values
+	if len(args) > 0 && args[0] == "sweep" {
+		return Sweep(args[1:])
+	}
 
-	sky_width , err_2 := strconv.ParseFloat(os.Args[2], 64)
-	Check(err_2)
+	// read the named flags (and the optional -config run file), and check them all before starting
+	// ./boids -numBoids 200 -skyWidth 2000 ... or ./boids -config run.json -numGens 500
+	params, err := ParseParameters(args)
+	if err != nil {
+		return err
+	}
 
-	initial_speed , err_3 := strconv.ParseFloat(os.Args[3], 64)
-	Check(err_3)
+	fmt.Println("Command line arguements read")
 
-	max_boid_speed , err_4 := strconv.ParseFloat(os.Args[4], 64)
-	Check(err_4)
+	// all files of the run share this prefix; create its directory if needed
+	output_file := OutputFile(params, time.Now())
+	if err := os.MkdirAll(filepath.Dir(output_file), 0o755); err != nil {
+		return err
+	}
 
-	num_gens, err_5 := strconv.Atoi(os.Args[5])
-	Check(err_5)
+	// pick a seed if none was given, and record it so that the run can be regenerated
+	if params.Seed == 0 {
+		params.Seed = time.Now().UnixNano()
+	}
+	fmt.Println("Random seed:", params.Seed)
+	if err := SaveParameters(output_file+".params.json", params); err != nil {
+		return err
+	}
+	fmt.Println("Parameters recorded in", output_file+".params.json")
 
-	proximity, err_6 := strconv.ParseFloat(os.Args[6], 64)
-	Check(err_6)
+	fmt.Println("Simulating boids")
 
-	separation_factor, err_7 := strconv.ParseFloat(os.Args[7], 64)
-	Check(err_7)
+	// generate initial sky
+	initial_sky, err := InitialSky(params)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Initial sky generated")
 
-	alignment_factor, err_8 := strconv.ParseFloat(os.Args[8], 64)
-	Check(err_8)
+	if err := RunSimulationWithManifest(NewManifest(params, args), "run", params, output_file, initial_sky, nil); err != nil {
+		return err
+	}
+	fmt.Println("Simulation run")
+	fmt.Println("GIF drawn in", output_file+".out.gif")
+	fmt.Println("Run described in", ManifestFile(output_file))
 
-	cohesion_factor, err_9 := strconv.ParseFloat(os.Args[9], 64)
-	Check(err_9)
-	
-	time_step, err_10 := strconv.ParseFloat(os.Args[10], 64)
-	Check(err_10)
+	return nil
+}
 
-	canvas_width, err_11 := strconv.Atoi(os.Args[11])
-	Check(err_11)
+// Resume continues the run recorded in a checkpoint file; args are the flags after "resume"
+func Resume(args []string) error {
+	fs := flag.NewFlagSet("boids resume", flag.ContinueOnError)
+	checkpoint_file := fs.String("checkpoint", CheckpointFile(DefaultParameters().Output), "checkpoint written by a previous run")
+	num_gens := fs.Int("numGens", 0, "total number of generations of the run, to extend it (0 keeps the original number)")
+	if err := fs.Parse(args); err != nil {
+		return UsageError(err)
+	}
 
-	image_frequency, err_12 := strconv.Atoi(os.Args[12])
-	Check(err_12)
+	checkpoint, err := LoadCheckpoint(*checkpoint_file)
+	if err != nil {
+		return err
+	}
 
-	if image_frequency <= 0 {
-		panic("Error: nonpositive number as drawing_frequency")
+	params := checkpoint.Parameters
+	if *num_gens > 0 {
+		params.NumGens = *num_gens
+	}
+	if err := ValidateParameters(params); err != nil {
+		return err
 	}
+	fmt.Println("Resuming from generation", checkpoint.Generation, "of", params.NumGens, "with random seed", params.Seed)
 
-	output_file := "output/" + "test_boids"
+	// the resumed session is added to the manifest of the run
+	manifest, err := LoadManifest(ManifestFile(checkpoint.OutputFile))
+	if err != nil {
+		manifest = NewManifest(params, nil)
+	}
+	if err := RunSimulationWithManifest(manifest, "resume", params, checkpoint.OutputFile, SkyFromCheckpoint(checkpoint), &checkpoint); err != nil {
+		return err
+	}
+	fmt.Println("Simulation run")
+	fmt.Println("GIF drawn in", checkpoint.OutputFile+".out.gif")
 
-	fmt.Println("Command line arguements read")
+	return nil
+}
 
-	fmt.Println("Simulating boids")
+// RunSimulation simulates current_sky up to generation params.NumGens and writes the outputs under the prefix output_file.
+// Frames are drawn and written while the simulation runs, so only the current generation is kept in memory.
+// If checkpoint is not nil, current_sky is the sky of the checkpointed generation and the outputs are continued from where the checkpoint left them.
+func RunSimulation(params Parameters, output_file string, current_sky Sky, checkpoint *Checkpoint) error {
+	if err := ValidateParameters(params); err != nil {
+		return err
+	}
 
-	// generate initial sky
-	initial_sky := GenerateRandomSky(num_boids, sky_width, initial_speed, max_boid_speed, proximity, separation_factor, alignment_factor, cohesion_factor)
-	fmt.Println("Initial sky generated")
+	// Defining configuration settings for animation.
+	config := MakeConfig(params)
 
-	// Call simulation function
-	time_points := SimulateBoids(initial_sky, num_gens, time_step)
-	fmt.Println("Simulation run")
+	start_gen := 0
+	gif_file := output_file + ".out.gif"
+	canvas_width, canvas_height := CanvasSize(config, current_sky)
 
-	// Defining configuration settings for animation.
-	config := Config{
-		CanvasWidth:     canvas_width,
-		BoidSize:        5.0, // Set the boid size
-		BoidColor:       Color{R: 255, G: 255, B: 255, A: 255},
-		BackgroundColor: Color{R: 173, G: 216, B: 230}, // Light blue background
-	}
-
-	// Call AnimateSystem using the config parameter
-	fmt.Println("Drawing sky")
-	images := AnimateSystem(time_points, config, image_frequency)
-	fmt.Println("Image drawn")
-
-	// Then, render an animated GIF.
-	fmt.Println("Making GIF")
-	gifhelper.ImagesToGIF(images, output_file)
-	fmt.Println("GIF drawn!")
+	var gif_writer *GIFWriter
+	var err error
+	if checkpoint == nil {
+		gif_writer, err = CreateGIF(gif_file, canvas_width, canvas_height)
+	} else {
+		start_gen = checkpoint.Generation
+		gif_writer, err = OpenGIF(gif_file, canvas_width, canvas_height, checkpoint.Outputs[gif_file])
+	}
+	if err != nil {
+		return err
+	}
+
+	// the trajectory, metrics and flocks files, continued like the GIF when resuming
+	series, err := OpenSeriesOutputs(params, output_file, checkpoint)
+	if err != nil {
+		gif_writer.Close()
+		return err
+	}
+	defer func() {
+		for _, output := range series {
+			output.writer.Close()
+		}
+	}()
+
+	// Call simulation function, drawing every imageFrequency-th sky,
+	// exporting every trajectoryFrequency-th sky to the trajectory files,
+	// recording the flock metrics of every metricsFrequency-th sky and the flocks of every flocksFrequency-th sky,
+	// saving every snapshotFrequency-th sky for numerical inspection
+	// and checkpointing every checkpointFrequency-th generation
+	last_sky := current_sky
+	err = StreamBoids(current_sky, params.NumGens-start_gen, params.TimeStep, params.Parallel, func(step int, sky Sky) error {
+		gen := start_gen + step
+		last_sky = sky
+
+		// the outputs of the checkpointed generation were written before the checkpoint
+		if checkpoint != nil && step == 0 {
+			return nil
+		}
+
+		if params.SnapshotFrequency > 0 && gen%params.SnapshotFrequency == 0 {
+			if err := SaveSky(SnapshotFile(output_file, gen, params.SnapshotFormat), sky); err != nil {
+				return err
+			}
+		}
+
+		if gen%params.ImageFrequency == 0 {
+			if err := gif_writer.AddFrame(DrawToCanvas(sky, config)); err != nil {
+				return err
+			}
+		}
+
+		// the writers of this generation share one frame, so that its flocks are found once
+		frame := NewSeriesFrame(gen, sky)
+		for _, output := range series {
+			if gen%output.frequency == 0 {
+				if err := output.writer.WriteSky(frame); err != nil {
+					return err
+				}
+			}
+		}
+
+		if params.CheckpointFrequency > 0 && gen%params.CheckpointFrequency == 0 {
+			gif_size, err := gif_writer.Size()
+			if err != nil {
+				return err
+			}
+			outputs := map[string]int64{gif_file: gif_size}
+			for filename, output := range series {
+				if outputs[filename], err = output.writer.Size(); err != nil {
+					return err
+				}
+			}
+			return SaveCheckpoint(CheckpointFile(output_file), MakeCheckpoint(params, output_file, gen, sky, outputs))
+		}
+
+		return nil
+	})
+	if err != nil {
+		gif_writer.Close()
+		return err
+	}
+
+	for filename, output := range series {
+		delete(series, filename)
+		if err := output.writer.Close(); err != nil {
+			gif_writer.Close()
+			return err
+		}
+	}
+
+	if len(last_sky.predators) > 0 {
+		fmt.Println("Boids caught by predators:", last_sky.captures, "of", last_sky.captures+len(last_sky.boids))
+	}
+
+	return gif_writer.Close()
 }
 
-func Check(err error) {
+// seriesOutput is an output file that gets a row for every frequency-th generation
+type seriesOutput struct {
+	writer    SeriesWriter
+	frequency int
+}
+
+// OpenSeriesOutputs creates the trajectory, metrics and flocks files requested by params, keyed by file name,
+// or reopens them where checkpoint left them
+func OpenSeriesOutputs(params Parameters, output_file string, checkpoint *Checkpoint) (map[string]seriesOutput, error) {
+	series := make(map[string]seriesOutput)
+	close_all := func() {
+		for _, output := range series {
+			output.writer.Close()
+		}
+	}
+
+	formats, err := ParseTrajectoryFormats(params.Trajectory)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	if len(formats) > 0 && params.TrajectoryFrequency <= 0 {
+		return nil, fmt.Errorf("nonpositive trajectoryFrequency %d", params.TrajectoryFrequency)
+	}
+
+	for _, format := range formats {
+		filename := TrajectoryFile(output_file, format)
+		var t *TrajectoryWriter
+		if checkpoint == nil {
+			t, err = CreateTrajectory(filename, format)
+		} else {
+			t, err = OpenTrajectory(filename, format, checkpoint.Outputs[filename])
+		}
+		if err != nil {
+			close_all()
+			return nil, err
+		}
+		series[filename] = seriesOutput{writer: t, frequency: params.TrajectoryFrequency}
+	}
+
+	if params.MetricsFrequency > 0 {
+		filename := MetricsFile(output_file)
+		var m *MetricsWriter
+		if checkpoint == nil {
+			m, err = CreateMetrics(filename)
+		} else {
+			m, err = OpenMetrics(filename, checkpoint.Outputs[filename])
+		}
+		if err != nil {
+			close_all()
+			return nil, err
+		}
+		series[filename] = seriesOutput{writer: m, frequency: params.MetricsFrequency}
+	}
+
+	if params.FlocksFrequency > 0 {
+		filename := FlocksFile(output_file)
+		var fw *FlocksWriter
+		if checkpoint == nil {
+			fw, err = CreateFlocks(filename)
+		} else {
+			fw, err = OpenFlocks(filename, checkpoint.Outputs[filename])
+		}
+		if err != nil {
+			close_all()
+			return nil, err
+		}
+		series[filename] = seriesOutput{writer: fw, frequency: params.FlocksFrequency}
+	}
+
+	return series, nil
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Manifest describes a run directory: the software that produced it, the exact parameters and seed,
+// and the timing of every session that worked on it (the first run and each resume).
+type Manifest struct {
+	Version    string            `json:"version"`
+	GoVersion  string            `json:"goVersion"`
+	Args       []string          `json:"args"`
+	Seed       int64             `json:"seed"`
+	Parameters Parameters        `json:"parameters"`
+	Sessions   []ManifestSession `json:"sessions"`
+}
+
+// ManifestSession is one execution of the program on a run
+type ManifestSession struct {
+	Command        string     `json:"command"` // "run" or "resume"
+	Start          time.Time  `json:"start"`
+	End            *time.Time `json:"end,omitempty"` // nil while the session runs or if it was killed
+	Seconds        float64    `json:"seconds"`
+	FromGeneration int        `json:"fromGeneration"`
+	ToGeneration   int        `json:"toGeneration"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// SweepManifest describes a sweep directory as Manifest describes a run: the software, the command-line arguments,
+// the shared parameters and the timing of the sweep, followed by its axes and every run with its own parameters and seed,
+// so that any run of the sweep can be audited, or run again on its own from its parameters.
+type SweepManifest struct {
+	Manifest
+	Axes []SweepAxis        `json:"axes"`
+	Runs []SweepManifestRun `json:"runs"`
+}
+
+// SweepManifestRun is one run of a sweep, in the order of the rows of the summary table
+type SweepManifestRun struct {
+	Values     []string   `json:"values"` // Values[k] is the value of axis k
+	Replicate  int        `json:"replicate"`
+	Seed       int64      `json:"seed"`
+	Parameters Parameters `json:"parameters"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ManifestFile returns the name of the manifest written for the output file prefix output_file
+func ManifestFile(output_file string) string {
+	return output_file + ".manifest.json"
+}
+
+// SoftwareVersion returns the module version and version control revision the program was built from, as far as Go recorded them
+func SoftwareVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision":
+			version += " " + setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true":
+			version += " (modified)"
+		}
+	}
+
+	return version
+}
+
+// NewManifest returns the manifest of a new run with the given parameters and command-line arguments
+func NewManifest(params Parameters, args []string) Manifest {
+	return Manifest{
+		Version:    SoftwareVersion(),
+		GoVersion:  runtime.Version(),
+		Args:       args,
+		Seed:       params.Seed,
+		Parameters: params,
+	}
+}
+
+// NewSweepManifest returns the manifest of a sweep with the shared parameters params, its command-line arguments, axes and runs,
+// and starts its session
+func NewSweepManifest(params Parameters, args []string, axes []SweepAxis, runs []SweepRun) SweepManifest {
+	manifest := SweepManifest{Manifest: NewManifest(params, args), Axes: axes}
+	manifest.Sessions = []ManifestSession{{Command: "sweep", Start: time.Now(), ToGeneration: params.NumGens}}
+
+	for _, run := range runs {
+		manifest.Runs = append(manifest.Runs, SweepManifestRun{Values: run.Values, Replicate: run.Replicate, Seed: run.Seed, Parameters: run.Params})
+	}
+
+	return manifest
+}
+
+// EndSweep records the timing of the sweep session and the error of every run that failed
+func (manifest *SweepManifest) EndSweep(results []SweepResult) {
+	end := time.Now()
+	session := &manifest.Sessions[len(manifest.Sessions)-1]
+	session.End = &end
+	session.Seconds = end.Sub(session.Start).Seconds()
+
+	for k, result := range results {
+		if result.Err != nil {
+			manifest.Runs[k].Error = result.Err.Error()
+			if session.Error == "" {
+				session.Error = fmt.Sprintf("sweep run %d: %v", k, result.Err)
+			}
+		}
+	}
+}
+
+// SaveManifest writes manifest, a Manifest or a SweepManifest, to filename as indented JSON
+func SaveManifest(filename string, manifest any) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// LoadManifest reads a manifest written by SaveManifest
+func LoadManifest(filename string) (Manifest, error) {
+	var manifest Manifest
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// RunSimulationWithManifest runs RunSimulation as one session of manifest. The manifest is saved when the session starts,
+// so that an interrupted session still shows up, and again with its timing (or error) when it ends.
+func RunSimulationWithManifest(manifest Manifest, command string, params Parameters, output_file string, current_sky Sky, checkpoint *Checkpoint) error {
+	manifest_file := ManifestFile(output_file)
+
+	session := ManifestSession{Command: command, Start: time.Now(), ToGeneration: params.NumGens}
+	if checkpoint != nil {
+		session.FromGeneration = checkpoint.Generation
+	}
+	manifest.Parameters = params
+	manifest.Sessions = append(manifest.Sessions, session)
+	if err := SaveManifest(manifest_file, manifest); err != nil {
+		return err
+	}
+
+	err := RunSimulation(params, output_file, current_sky, checkpoint)
+
+	end := time.Now()
+	last := &manifest.Sessions[len(manifest.Sessions)-1]
+	last.End = &end
+	last.Seconds = end.Sub(last.Start).Seconds()
+	if err != nil {
+		last.Error = err.Error()
+	}
+
+	if save_err := SaveManifest(manifest_file, manifest); err == nil {
+		err = save_err
+	}
+
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestOutputFile checks the output prefix with and without timestamped run directories
+func TestOutputFile(t *testing.T) {
+	params := DefaultParameters()
+	start := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+
+	if result := OutputFile(params, start); result != "output/test_boids" {
+		t.Errorf("OutputFile = %q, want output/test_boids", result)
+	}
+
+	params.Output, params.Timestamp = filepath.Join("runs", "flock"), true
+	if result, want := OutputFile(params, start), filepath.Join("runs", "flock-20240309-140507", "flock"); result != want {
+		t.Errorf("OutputFile = %q, want %q", result, want)
+	}
+}
+
+// TestRunSimulationWithManifest checks that a run and its resumed session are both recorded in the manifest
+func TestRunSimulationWithManifest(t *testing.T) {
+	params := DefaultParameters()
+	params.NumBoids, params.SkyWidth, params.NumGens, params.Seed = 10, 300, 20, 4
+	params.CanvasWidth, params.ImageFrequency, params.CheckpointFrequency = 30, 10, 10
+	output_file := filepath.Join(t.TempDir(), "run")
+
+	initial_sky, err := InitialSky(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RunSimulationWithManifest(NewManifest(params, []string{"-seed", "4"}), "run", params, output_file, initial_sky, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := LoadCheckpoint(CheckpointFile(output_file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := LoadManifest(ManifestFile(output_file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Parameters.NumGens = 30
+	if err := RunSimulationWithManifest(manifest, "resume", checkpoint.Parameters, output_file, SkyFromCheckpoint(checkpoint), &checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err = LoadManifest(ManifestFile(output_file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Seed != 4 || manifest.Parameters.NumGens != 30 || len(manifest.Args) != 2 || manifest.Version == "" {
+		t.Errorf("manifest %+v", manifest)
+	}
+	if len(manifest.Sessions) != 2 {
+		t.Fatalf("manifest has %d sessions, want 2", len(manifest.Sessions))
+	}
+
+	resumed := manifest.Sessions[1]
+	if resumed.Command != "resume" || resumed.FromGeneration != 20 || resumed.ToGeneration != 30 || resumed.End == nil || resumed.Error != "" {
+		t.Errorf("resumed session %+v", resumed)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+var forceModelNames = []string{
+	ClassicModel:  "classic",
+	ReynoldsModel: "reynolds",
+	VicsekModel:   "vicsek",
+}
+
+// String returns the name of the force model used in flags and run files
+func (model ForceModel) String() string {
+	if model < 0 || int(model) >= len(forceModelNames) {
+		return fmt.Sprintf("ForceModel(%d)", int(model))
+	}
+	return forceModelNames[model]
+}
+
+// MarshalText writes the force model by name, so that run files read "model": "vicsek"
+func (model ForceModel) MarshalText() ([]byte, error) {
+	return []byte(model.String()), nil
+}
+
+// UnmarshalText reads a force model by name
+func (model *ForceModel) UnmarshalText(text []byte) error {
+	for m, name := range forceModelNames {
+		if string(text) == name {
+			*model = ForceModel(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown force model %q (want classic, reynolds or vicsek)", text)
+}
+
+// ModelRule returns the rule that acts under the name name on a boid of species s in current_sky:
+// in the Reynolds model the classic rules steer toward a desired velocity, and every other rule is the registered one
+func ModelRule(current_sky Sky, name string, s int) (Rule, bool) {
+	if current_sky.model == ReynoldsModel && (name == "separation" || name == "alignment" || name == "cohesion") {
+		return ReynoldsRule{Name: name, MaxSpeed: SpeciesMaxSpeed(current_sky, s), MaxForce: current_sky.maxForce}, true
+	}
+
+	rule, ok := ruleRegistry[name]
+	return rule, ok
+}
+
+// ReynoldsRule is a classic rule in the form of Reynolds' steering behaviors: the neighbors give a desired direction,
+// the boid would like to fly that way at MaxSpeed, and the force is the difference between that desired velocity and its own,
+// clamped to MaxForce and multiplied by the mean factor of the neighbors
+type ReynoldsRule struct {
+	Name               string // separation, alignment or cohesion
+	MaxSpeed, MaxForce float64
+}
+
+// Force returns the steering force of the rule
+func (rule ReynoldsRule) Force(b Boid, neighbors []Neighbor) OrderedPair {
+	var desired OrderedPair
+	factor := 0.0
+
+	if len(neighbors) == 0 {
+		return desired
+	}
+
+	for _, n := range neighbors {
+		switch rule.Name {
+		case "separation":
+			// away from each neighbor, more strongly the closer it is
+			desired.x += (b.position.x - n.Boid.position.x) / (n.Distance * n.Distance)
+			desired.y += (b.position.y - n.Boid.position.y) / (n.Distance * n.Distance)
+		case "alignment":
+			desired.x += n.Boid.velocity.x
+			desired.y += n.Boid.velocity.y
+		case "cohesion":
+			// toward the center of the neighbors
+			desired.x += n.Boid.position.x - b.position.x
+			desired.y += n.Boid.position.y - b.position.y
+		}
+		factor += n.Factor
+	}
+	factor /= float64(len(neighbors))
+
+	steer := Steer(b.velocity, desired, rule.MaxSpeed, rule.MaxForce)
+	return OrderedPair{x: factor * steer.x, y: factor * steer.y}
+}
+
+// Steer returns the force turning velocity into a velocity of max_speed in the direction of desired, clamped to max_force.
+// A desired direction of 0 asks for no steering.
+func Steer(velocity, desired OrderedPair, max_speed, max_force float64) OrderedPair {
+	length := math.Hypot(desired.x, desired.y)
+	if length == 0 {
+		return OrderedPair{}
+	}
+
+	steer := OrderedPair{x: desired.x/length*max_speed - velocity.x, y: desired.y/length*max_speed - velocity.y}
+	if size := math.Hypot(steer.x, steer.y); size > max_force {
+		steer.x *= max_force / size
+		steer.y *= max_force / size
+	}
+
+	return steer
+}
+
+// DrawNoise draws, in the order of the boids, the random turn of every boid of current_sky for one generation of the Vicsek model:
+// an angle uniform between -noise/2 and noise/2. Drawing them all before the boids are updated
+// keeps the parallel update identical to the serial one. Other models, and a Vicsek sky without noise, draw nothing.
+func DrawNoise(current_sky Sky) []float64 {
+	if current_sky.model != VicsekModel || current_sky.noise == 0 {
+		return nil
+	}
+
+	noise := make([]float64, len(current_sky.boids))
+	for i := range noise {
+		noise[i] = current_sky.noise * (current_sky.rng.Float64() - 0.5)
+	}
+
+	return noise
+}
+
+// VicsekUpdate moves boid i of current_sky one time step in the Vicsek model: it flies at the maximum speed of its species
+// in the mean heading of itself and the neighbors it sees in its alignment cone, turned by noise (in radians).
+// The forces, soft walls and predators play no part; the edges of the sky and the obstacles still do.
+func VicsekUpdate(current_sky Sky, i int, noise, time_step float64) Boid {
+	b := current_sky.boids[i]
+	angle := ConeAngle(current_sky.vision, current_sky.vision.AlignmentAngle)
+
+	// the boid counts its own heading, so that a boid without neighbors keeps flying straight
+	var heading OrderedPair
+	neighbors := append([]Neighbor{{Boid: b}}, NeighborsInRange(current_sky, b)...)
+	for k, n := range neighbors {
+		if k > 0 && !InView(b, n.Boid.position, angle) {
+			continue
+		}
+		if speed := math.Hypot(n.Boid.velocity.x, n.Boid.velocity.y); speed > 0 {
+			heading.x += n.Boid.velocity.x / speed
+			heading.y += n.Boid.velocity.y / speed
+		}
+	}
+
+	theta := math.Atan2(heading.y, heading.x) + noise
+	speed := SpeciesMaxSpeed(current_sky, b.species)
+
+	b.velocity = OrderedPair{x: speed * math.Cos(theta), y: speed * math.Sin(theta)}
+	b.position.x += b.velocity.x * time_step
+	b.position.y += b.velocity.y * time_step
+	b.acceleration = OrderedPair{}
+
+	return b
+}
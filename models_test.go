@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestForceModelText checks that force models are read and written by name
+func TestForceModelText(t *testing.T) {
+	for _, model := range []ForceModel{ClassicModel, ReynoldsModel, VicsekModel} {
+		text, _ := model.MarshalText()
+		var result ForceModel
+		if err := result.UnmarshalText(text); err != nil || result != model {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, result, err, model)
+		}
+	}
+
+	var model ForceModel
+	if err := model.UnmarshalText([]byte("boids")); err == nil {
+		t.Errorf("UnmarshalText accepted an unknown force model")
+	}
+}
+
+// TestSteer checks the desired velocity at full speed, the clamping to the largest force, and no steering without a direction
+func TestSteer(t *testing.T) {
+	tests := []struct {
+		velocity, desired    OrderedPair
+		max_speed, max_force float64
+		result               OrderedPair
+	}{
+		{OrderedPair{x: 1, y: 0}, OrderedPair{x: 3, y: 4}, 2, 10, OrderedPair{x: 0.2, y: 1.6}},
+		{OrderedPair{x: 1, y: 0}, OrderedPair{x: 0, y: 7}, 1, 0.5, OrderedPair{x: -0.5 / math.Sqrt2, y: 0.5 / math.Sqrt2}},
+		{OrderedPair{x: 2, y: 0}, OrderedPair{x: 5, y: 0}, 2, 1, OrderedPair{}},
+		{OrderedPair{x: 1, y: 1}, OrderedPair{}, 2, 1, OrderedPair{}},
+	}
+
+	for _, test := range tests {
+		result := Steer(test.velocity, test.desired, test.max_speed, test.max_force)
+		if math.Abs(result.x-test.result.x) > 1e-12 || math.Abs(result.y-test.result.y) > 1e-12 {
+			t.Errorf("Steer(velocity: %v, desired: %v, max speed: %v, max force: %v) = %v, want %v",
+				test.velocity, test.desired, test.max_speed, test.max_force, result, test.result)
+		}
+	}
+}
+
+// TestReynoldsRules checks each classic rule in the Reynolds model against its desired direction,
+// and ComputeNetForce of a Reynolds sky against the sum of the rules
+func TestReynoldsRules(t *testing.T) {
+	b := Boid{position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}}
+	other := Boid{id: 1, position: OrderedPair{x: 53, y: 54}, velocity: OrderedPair{x: 0, y: 1}}
+	neighbors := []Neighbor{{Boid: other, Distance: 5, Factor: 2}}
+
+	for name, desired := range map[string]OrderedPair{
+		"separation": {x: -3, y: -4},
+		"alignment":  {x: 0, y: 1},
+		"cohesion":   {x: 3, y: 4},
+	} {
+		result := ReynoldsRule{Name: name, MaxSpeed: 2, MaxForce: 0.5}.Force(b, neighbors)
+		steer := Steer(b.velocity, desired, 2, 0.5)
+		if want := (OrderedPair{x: 2 * steer.x, y: 2 * steer.y}); math.Abs(result.x-want.x) > 1e-12 || math.Abs(result.y-want.y) > 1e-12 {
+			t.Errorf("Reynolds %s rule = %v, want %v", name, result, want)
+		}
+		if result := (ReynoldsRule{Name: name, MaxSpeed: 2, MaxForce: 0.5}).Force(b, nil); result != (OrderedPair{}) {
+			t.Errorf("Reynolds %s rule without neighbors = %v, want 0", name, result)
+		}
+	}
+
+	sky := Sky{width: 100, height: 100, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2, maxBoidSpeed: 2}
+	sky.boids = []Boid{b, other}
+	sky.model, sky.maxForce = ReynoldsModel, 0.5
+
+	s := Steer(b.velocity, OrderedPair{x: -3, y: -4}, 2, 0.5)
+	a := Steer(b.velocity, OrderedPair{x: 0, y: 1}, 2, 0.5)
+	c := Steer(b.velocity, OrderedPair{x: 3, y: 4}, 2, 0.5)
+	want := OrderedPair{x: 1.5*s.x + a.x + 0.2*c.x, y: 1.5*s.y + a.y + 0.2*c.y}
+	if result := ComputeNetForce(sky, b); math.Abs(result.x-want.x) > 1e-12 || math.Abs(result.y-want.y) > 1e-12 {
+		t.Errorf("ComputeNetForce in the Reynolds model = %v, want %v", result, want)
+	}
+}
+
+// TestVicsekUpdate checks that a boid takes the mean heading of itself and its neighbors at the maximum speed,
+// turned by its noise
+func TestVicsekUpdate(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 10, maxBoidSpeed: 2, model: VicsekModel}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 0.5, y: 0}},
+		{id: 1, position: OrderedPair{x: 53, y: 54}, velocity: OrderedPair{x: 0, y: 3}},
+		{id: 2, position: OrderedPair{x: 80, y: 50}, velocity: OrderedPair{x: -1, y: 0}}, // beyond proximity
+	}
+
+	for _, noise := range []float64{0, 0.3} {
+		result := VicsekUpdate(sky, 0, noise, 0.5)
+		theta := math.Pi/4 + noise
+		want_velocity := OrderedPair{x: 2 * math.Cos(theta), y: 2 * math.Sin(theta)}
+		want_position := OrderedPair{x: 50 + 0.5*want_velocity.x, y: 50 + 0.5*want_velocity.y}
+
+		if math.Abs(result.velocity.x-want_velocity.x) > 1e-12 || math.Abs(result.velocity.y-want_velocity.y) > 1e-12 ||
+			math.Abs(result.position.x-want_position.x) > 1e-12 || math.Abs(result.position.y-want_position.y) > 1e-12 {
+			t.Errorf("VicsekUpdate(noise: %v) = %+v, want velocity %v and position %v", noise, result, want_velocity, want_position)
+		}
+	}
+
+	// a lone boid flies straight on
+	if result := VicsekUpdate(sky, 2, 0, 1); math.Abs(result.velocity.x+2) > 1e-12 || math.Abs(result.velocity.y) > 1e-12 {
+		t.Errorf("VicsekUpdate of a lone boid = %v, want (-2, 0)", result.velocity)
+	}
+}
+
+// TestVicsekModel runs the Vicsek model: without noise the flock orders itself, the parallel update draws the same noise
+// as the serial one, and the model and its noise survive a snapshot
+func TestVicsekModel(t *testing.T) {
+	vicsek_sky := func(noise float64) Sky {
+		sky := GenerateRandomSky(200, 300, 300, 1.0, 1.0, 50, 1.5, 1.0, 0.02, 11)
+		sky.model, sky.noise = VicsekModel, noise
+		return sky
+	}
+
+	time_points, err := SimulateBoids(vicsek_sky(0), 200, 1.0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := ComputeFlockMetrics(time_points[0]), ComputeFlockMetrics(time_points[len(time_points)-1])
+	if last.Polarization < 0.9 || last.Polarization <= first.Polarization {
+		t.Errorf("polarization without noise went from %v to %v, want above 0.9", first.Polarization, last.Polarization)
+	}
+	for _, b := range time_points[len(time_points)-1].boids {
+		if speed := math.Hypot(b.velocity.x, b.velocity.y); math.Abs(speed-1) > 1e-12 {
+			t.Fatalf("boid %d flies at %v, want the constant speed 1", b.id, speed)
+		}
+	}
+
+	// serial and parallel skies each have their own generator, seeded alike
+	serial_sky, parallel_sky := vicsek_sky(1), vicsek_sky(1)
+	for gen := 1; gen <= 50; gen++ {
+		serial_sky = UpdateSkyOrFail(t, serial_sky, 1.0, 1)
+		parallel_sky = UpdateSkyOrFail(t, parallel_sky, 1.0, 4)
+	}
+	if !reflect.DeepEqual(MakeSkySnapshot(serial_sky), MakeSkySnapshot(parallel_sky)) {
+		t.Errorf("UpdateSkyParallel in the Vicsek model differs from UpdateSky")
+	}
+
+	snapshot_file := filepath.Join(t.TempDir(), "sky.json")
+	if err := SaveSky(snapshot_file, serial_sky); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSky(snapshot_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.model != VicsekModel || loaded.noise != 1 {
+		t.Errorf("LoadSky read model %v with noise %v, want vicsek with noise 1", loaded.model, loaded.noise)
+	}
+}
+
+// TestForceModelsRun runs every force model through the same parameters and pipeline
+func TestForceModelsRun(t *testing.T) {
+	for _, model := range []string{"classic", "reynolds", "vicsek"} {
+		params, err := ParseParameters([]string{"-model", model, "-numBoids", "50", "-numGens", "30", "-skyWidth", "400"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sky, err := InitialSky(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sky.model.String() != model {
+			t.Fatalf("InitialSky made a %v sky, want %s", sky.model, model)
+		}
+		if _, err := SimulateBoids(sky, params.NumGens, params.TimeStep, true); err != nil {
+			t.Errorf("%s model: %v", model, err)
+		}
+	}
+
+	if _, err := ParseParameters([]string{"-model", "vicsek", "-noise", "7"}); err == nil {
+		t.Errorf("ParseParameters accepted a noise above 2π")
+	}
+}
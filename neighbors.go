@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+var neighborModeNames = []string{
+	MetricNeighbors:      "metric",
+	TopologicalNeighbors: "topological",
+}
+
+// String returns the name of the neighbor mode used in flags and run files
+func (mode NeighborMode) String() string {
+	if mode < 0 || int(mode) >= len(neighborModeNames) {
+		return fmt.Sprintf("NeighborMode(%d)", int(mode))
+	}
+	return neighborModeNames[mode]
+}
+
+// MarshalText writes the neighbor mode by name, so that run files read "neighborMode": "topological"
+func (mode NeighborMode) MarshalText() ([]byte, error) {
+	return []byte(mode.String()), nil
+}
+
+// UnmarshalText reads a neighbor mode by name
+func (mode *NeighborMode) UnmarshalText(text []byte) error {
+	for m, name := range neighborModeNames {
+		if string(text) == name {
+			*mode = NeighborMode(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown neighbor mode %q (want metric or topological)", text)
+}
+
+// NearestNeighbors returns, in ascending order, the indices of the k boids of current_sky nearest to boid b
+// (fewer if there are not that many), leaving out b itself and boids at exactly b's position.
+// Distances go across the edges of a wrapping sky, and ties are broken by the lower index, so the grid does not change the result.
+// With a spatial grid, rings of cells around b are searched outward only until the k nearest are certain to be found.
+func NearestNeighbors(current_sky Sky, b Boid, k int) []int {
+	type candidate struct {
+		index    int
+		distance float64
+	}
+	var candidates []candidate
+
+	add := func(i int) {
+		other := current_sky.boids[i]
+		if other.id == b.id {
+			return
+		}
+		if d := Distance(b.position, MinimumImage(current_sky, b.position, other.position)); d > 0 {
+			candidates = append(candidates, candidate{i, d})
+		}
+	}
+
+	grid := current_sky.grid
+	if grid == nil {
+		for i := range current_sky.boids {
+			add(i)
+		}
+	} else {
+		col, row := CellColumnRow(grid, b.position)
+		cell_size := min(grid.cellWidth, grid.cellHeight)
+		seen := make(map[int]bool)
+
+		for r := 0; ; r++ {
+			cells, complete := RingCells(grid, col, row, r)
+			for _, cell := range cells {
+				// on a small wrapping grid a ring comes back onto cells of the inner rings
+				if seen[cell] {
+					continue
+				}
+				seen[cell] = true
+				for _, i := range grid.indices[grid.cellStart[cell]:grid.cellStart[cell+1]] {
+					add(i)
+				}
+			}
+
+			// every boid less than r cells away is now a candidate; stop once k of them are that close, or the grid is exhausted
+			covered := float64(r)*cell_size - 1e-9*math.Max(current_sky.width, current_sky.height)
+			close_enough := 0
+			for _, c := range candidates {
+				if c.distance <= covered {
+					close_enough++
+				}
+			}
+			if close_enough >= k || complete {
+				break
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].index < candidates[j].index
+	})
+
+	nearest := make([]int, 0, min(k, len(candidates)))
+	for _, c := range candidates[:min(k, len(candidates))] {
+		nearest = append(nearest, c.index)
+	}
+	sort.Ints(nearest)
+
+	return nearest
+}
+
+// RingCells returns the cells of grid at Chebyshev distance r from the cell in column col and row row,
+// wrapped around the edges of a wrapping grid and left out beyond the edges of any other grid,
+// and whether rings 0 to r together cover the whole grid
+func RingCells(grid *SpatialGrid, col, row, r int) ([]int, bool) {
+	var cells []int
+
+	for rr := row - r; rr <= row+r; rr++ {
+		for cc := col - r; cc <= col+r; cc++ {
+			if max(cc-col, col-cc, rr-row, row-rr) != r {
+				continue
+			}
+			if !grid.wrap && (cc < 0 || rr < 0 || cc >= grid.cols || rr >= grid.rows) {
+				continue
+			}
+			cells = append(cells, CellIndex(grid, cc, rr))
+		}
+	}
+
+	if grid.wrap {
+		return cells, 2*r+1 >= grid.cols && 2*r+1 >= grid.rows
+	}
+	return cells, col-r <= 0 && row-r <= 0 && col+r >= grid.cols-1 && row+r >= grid.rows-1
+}
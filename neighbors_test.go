@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestNearestNeighbors checks that the grid search finds exactly the k nearest boids of a full scan,
+// for dense and sparse skies, tiny and huge cells, and k larger than the number of boids
+func TestNearestNeighbors(t *testing.T) {
+	tests := []struct {
+		num_boids            int
+		sky_width, proximity float64
+	}{
+		{300, 1000, 100},
+		{300, 1000, 7},    // many tiny cells
+		{300, 1000, 5000}, // a single cell
+		{40, 1000, 20},    // sparse: the nearest boids are many cells away
+		{1, 1000, 100},
+	}
+
+	for seed, test := range tests {
+		for _, boundary := range []BoundaryMode{WrapBoundary, ReflectBoundary, OpenBoundary} {
+			sky := GenerateRandomSky(test.num_boids, test.sky_width, test.sky_width/2, 1.0, 2.0, test.proximity, 1.5, 1.0, 0.02, int64(seed))
+			sky.boundary = boundary
+			if test.num_boids > 3 {
+				// boids on the sky edge and on top of each other
+				sky.boids[0].position = OrderedPair{x: test.sky_width, y: test.sky_width / 2}
+				sky.boids[1].position = OrderedPair{x: 0, y: test.sky_width / 2}
+				sky.boids[2].position = sky.boids[3].position
+			}
+
+			indexed_sky := sky
+			indexed_sky.grid = BuildSpatialGrid(sky)
+
+			for _, k := range []int{1, 7, 50, 1000} {
+				for i, b := range sky.boids {
+					want := NearestNeighbors(sky, b, k)
+					result := NearestNeighbors(indexed_sky, b, k)
+
+					if !reflect.DeepEqual(result, want) {
+						t.Fatalf("NearestNeighbors with grid (boids: %d, proximity: %v, boundary: %v, k: %d) for boid %d = %v, want %v",
+							test.num_boids, test.proximity, boundary, k, i, result, want)
+					}
+					if len(want) > k || (len(want) < k && len(want) < test.num_boids-2) {
+						t.Fatalf("NearestNeighbors(k: %d) returned %d of %d boids", k, len(want), test.num_boids)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestNearestNeighborsWrap checks the distances across the edges of a wrapping sky and the tie between equally distant boids
+func TestNearestNeighborsWrap(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 10}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 1, y: 50}},
+		{id: 1, position: OrderedPair{x: 97, y: 50}}, // 4 away across the left edge
+		{id: 2, position: OrderedPair{x: 10, y: 50}}, // 9 away
+		{id: 3, position: OrderedPair{x: 1, y: 41}},  // 9 away, ties with boid 2
+		{id: 4, position: OrderedPair{x: 1, y: 45}},  // 5 away
+	}
+	sky.grid = BuildSpatialGrid(sky)
+
+	for k, want := range [][]int{{}, {1}, {1, 4}, {1, 2, 4}, {1, 2, 3, 4}} {
+		if result := NearestNeighbors(sky, sky.boids[0], k); !reflect.DeepEqual(result, want) {
+			t.Errorf("NearestNeighbors(k: %d) = %v, want %v", k, result, want)
+		}
+	}
+
+	sky.boundary = ReflectBoundary
+	sky.grid = BuildSpatialGrid(sky)
+	if result := NearestNeighbors(sky, sky.boids[0], 2); !reflect.DeepEqual(result, []int{2, 4}) {
+		t.Errorf("NearestNeighbors on a reflecting sky = %v, want [2 4]", result)
+	}
+}
+
+// TestComputeNetForceTopological checks that topological neighbors ignore proximity:
+// the k nearest boids act however far they are, and nearer ones crowd out farther ones
+func TestComputeNetForceTopological(t *testing.T) {
+	sky := Sky{width: 1000, height: 1000, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 500, y: 500}, velocity: OrderedPair{x: 1, y: 0}},
+		{id: 1, position: OrderedPair{x: 600, y: 500}, velocity: OrderedPair{x: 0, y: 1}},
+		{id: 2, position: OrderedPair{x: 500, y: 300}, velocity: OrderedPair{x: -1, y: 0}},
+	}
+	sky.neighborMode, sky.numNeighbors = TopologicalNeighbors, 1
+
+	b, nearest := sky.boids[0], sky.boids[1]
+	s := ComputeSeparationForce(b, nearest, 1.5, 100)
+	a := ComputeAlignmentForce(b, nearest, 1.0, 100)
+	c := ComputeCohesionForce(b, nearest, 0.2, 100)
+	want := OrderedPair{x: s.x + a.x + c.x, y: s.y + a.y + c.y}
+
+	for _, with_grid := range []bool{false, true} {
+		if with_grid {
+			sky.grid = BuildSpatialGrid(sky)
+		}
+		if result := ComputeNetForce(sky, b); math.Abs(result.x-want.x) > 1e-12 || math.Abs(result.y-want.y) > 1e-12 {
+			t.Errorf("ComputeNetForce(grid: %v) with one topological neighbor = %v, want %v", with_grid, result, want)
+		}
+	}
+
+	sky.neighborMode = MetricNeighbors
+	if result := ComputeNetForce(sky, b); result != (OrderedPair{}) {
+		t.Errorf("ComputeNetForce with metric neighbors = %v, want 0: every boid is beyond proximity", result)
+	}
+}
+
+// BenchmarkNearestNeighbors times one generation of topological force computations with the grid,
+// at the density of BenchmarkNetForce
+func BenchmarkNearestNeighbors(b *testing.B) {
+	proximity := 50.0
+	area_per_boid := math.Pi * proximity * proximity / 10
+
+	for _, num_boids := range []int{1000, 10000, 100000} {
+		sky_width := math.Sqrt(float64(num_boids) * area_per_boid)
+		sky := GenerateRandomSky(num_boids, sky_width, sky_width, 1.0, 2.0, proximity, 1.5, 1.0, 0.02, 1)
+		sky.neighborMode, sky.numNeighbors = TopologicalNeighbors, 7
+
+		b.Run(fmt.Sprintf("k=7/boids=%d", num_boids), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				indexed_sky := sky
+				indexed_sky.grid = BuildSpatialGrid(sky)
+				for i := range indexed_sky.boids {
+					UpdateAcceleration(indexed_sky, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Obstacle is a static circle or polygon in the sky. Boids steer away from it once they come within
+// avoidanceDistance of its surface, and are stopped at its surface if a step would take them into it or through it.
+type Obstacle struct {
+	center   OrderedPair   // center of a circle, mean of the vertices of a polygon
+	radius   float64       // radius of a circle, 0 for a polygon
+	vertices []OrderedPair // corners of a polygon in order around it, nil for a circle
+}
+
+// Scene is the JSON scene file read by -scene:
+//
+//	{"obstacles": [{"circle": {"center": [500, 500], "radius": 80}}, {"polygon": [[100, 100], [300, 100], [200, 250]]}]}
+type Scene struct {
+	Obstacles []ObstacleSnapshot `json:"obstacles"`
+}
+
+// ObstacleSnapshot is the serializable form of an Obstacle: either Circle or Polygon is set
+type ObstacleSnapshot struct {
+	Circle  *CircleSnapshot `json:"circle,omitempty"`
+	Polygon [][2]float64    `json:"polygon,omitempty"`
+}
+
+// CircleSnapshot is the serializable form of a circular obstacle
+type CircleSnapshot struct {
+	Center [2]float64 `json:"center"`
+	Radius float64    `json:"radius"`
+}
+
+// NewCircleObstacle returns a circular obstacle
+func NewCircleObstacle(center OrderedPair, radius float64) Obstacle {
+	return Obstacle{center: center, radius: radius}
+}
+
+// NewPolygonObstacle returns a polygonal obstacle with the given corners, listed in order around the polygon
+func NewPolygonObstacle(vertices []OrderedPair) Obstacle {
+	var o Obstacle
+
+	o.vertices = append([]OrderedPair(nil), vertices...)
+	for _, v := range vertices {
+		o.center.x += v.x / float64(len(vertices))
+		o.center.y += v.y / float64(len(vertices))
+	}
+
+	return o
+}
+
+// LoadScene reads the obstacles of a scene file
+func LoadScene(filename string) ([]Obstacle, error) {
+	var scene Scene
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scene); err != nil {
+		return nil, fmt.Errorf("reading scene %s: %w", filename, err)
+	}
+
+	obstacles, err := ObstaclesFromSnapshots(scene.Obstacles)
+	if err != nil {
+		return nil, fmt.Errorf("scene %s: %w", filename, err)
+	}
+
+	return obstacles, nil
+}
+
+// ObstaclesFromSnapshots converts serialized obstacles, checking that each is a proper circle or polygon
+func ObstaclesFromSnapshots(snapshots []ObstacleSnapshot) ([]Obstacle, error) {
+	var obstacles []Obstacle
+
+	for k, s := range snapshots {
+		if (s.Circle == nil) == (s.Polygon == nil) {
+			return nil, fmt.Errorf("obstacle %d must be either a circle or a polygon", k)
+		}
+
+		o := ObstacleFromSnapshot(s)
+		if err := ValidateObstacle(o); err != nil {
+			return nil, fmt.Errorf("obstacle %d: %w", k, err)
+		}
+		obstacles = append(obstacles, o)
+	}
+
+	return obstacles, nil
+}
+
+// ObstacleFromSnapshot converts one serialized obstacle: its circle if it has one, and its polygon otherwise
+func ObstacleFromSnapshot(s ObstacleSnapshot) Obstacle {
+	if s.Circle != nil {
+		return NewCircleObstacle(OrderedPair{x: s.Circle.Center[0], y: s.Circle.Center[1]}, s.Circle.Radius)
+	}
+
+	vertices := make([]OrderedPair, len(s.Polygon))
+	for i, v := range s.Polygon {
+		vertices[i] = OrderedPair{x: v[0], y: v[1]}
+	}
+	return NewPolygonObstacle(vertices)
+}
+
+// ObstacleSnapshots returns the serializable form of obstacles
+func ObstacleSnapshots(obstacles []Obstacle) []ObstacleSnapshot {
+	var snapshots []ObstacleSnapshot
+
+	for _, o := range obstacles {
+		if o.vertices == nil {
+			snapshots = append(snapshots, ObstacleSnapshot{Circle: &CircleSnapshot{Center: [2]float64{o.center.x, o.center.y}, Radius: o.radius}})
+			continue
+		}
+
+		polygon := make([][2]float64, len(o.vertices))
+		for i, v := range o.vertices {
+			polygon[i] = [2]float64{v.x, v.y}
+		}
+		snapshots = append(snapshots, ObstacleSnapshot{Polygon: polygon})
+	}
+
+	return snapshots
+}
+
+// ValidateObstacle checks that o is a circle of positive radius or a polygon of at least three corners, with finite coordinates
+func ValidateObstacle(o Obstacle) error {
+	finite := func(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
+
+	if o.vertices == nil {
+		if !(o.radius > 0) || !finite(o.radius) || !finite(o.center.x) || !finite(o.center.y) {
+			return fmt.Errorf("circle at %v needs a positive radius and finite coordinates, got radius %v", o.center, o.radius)
+		}
+		return nil
+	}
+
+	if len(o.vertices) < 3 {
+		return fmt.Errorf("polygon needs at least 3 corners, got %d", len(o.vertices))
+	}
+	for _, v := range o.vertices {
+		if !finite(v.x) || !finite(v.y) {
+			return errors.New("polygon corners must have finite coordinates")
+		}
+	}
+
+	return nil
+}
+
+// ObstacleSurface returns the signed distance from pos to the surface of o (negative inside o)
+// and the unit normal of the surface at the nearest surface point, pointing out of o
+func ObstacleSurface(o Obstacle, pos OrderedPair) (float64, OrderedPair) {
+	if o.vertices == nil {
+		d := Distance(pos, o.center)
+		if d == 0 {
+			return -o.radius, OrderedPair{x: 1, y: 0}
+		}
+		return d - o.radius, OrderedPair{x: (pos.x - o.center.x) / d, y: (pos.y - o.center.y) / d}
+	}
+
+	// nearest point on any edge, and whether pos is inside (even-odd rule)
+	nearest := math.Inf(1)
+	var closest OrderedPair
+	inside := false
+
+	for i := range o.vertices {
+		a, b := o.vertices[i], o.vertices[(i+1)%len(o.vertices)]
+
+		edge := OrderedPair{x: b.x - a.x, y: b.y - a.y}
+		t := 0.0
+		if length2 := edge.x*edge.x + edge.y*edge.y; length2 > 0 {
+			t = ((pos.x-a.x)*edge.x + (pos.y-a.y)*edge.y) / length2
+			t = math.Max(0, math.Min(t, 1))
+		}
+		q := OrderedPair{x: a.x + t*edge.x, y: a.y + t*edge.y}
+		if d := Distance(pos, q); d < nearest {
+			nearest, closest = d, q
+		}
+
+		if (a.y > pos.y) != (b.y > pos.y) && pos.x < a.x+(pos.y-a.y)/(b.y-a.y)*edge.x {
+			inside = !inside
+		}
+	}
+
+	if nearest == 0 {
+		// on the surface: point away from the middle of the polygon
+		away := OrderedPair{x: pos.x - o.center.x, y: pos.y - o.center.y}
+		length := math.Sqrt(away.x*away.x + away.y*away.y)
+		if length == 0 {
+			return 0, OrderedPair{x: 1, y: 0}
+		}
+		return 0, OrderedPair{x: away.x / length, y: away.y / length}
+	}
+
+	normal := OrderedPair{x: (pos.x - closest.x) / nearest, y: (pos.y - closest.y) / nearest}
+	if inside {
+		return -nearest, OrderedPair{x: -normal.x, y: -normal.y}
+	}
+	return nearest, normal
+}
+
+// ComputeObstacleForce returns the force steering boid b away from the obstacles of current_sky.
+// Each obstacle closer than avoidanceDistance pushes along its surface normal, with a strength growing
+// linearly from 0 at avoidanceDistance to avoidanceFactor at the surface.
+// On a wrapping sky an obstacle acts from its periodic image nearest to b.
+func ComputeObstacleForce(current_sky Sky, b Boid) OrderedPair {
+	var force OrderedPair
+
+	D := current_sky.avoidanceDistance
+	if D <= 0 {
+		return force
+	}
+
+	for _, o := range current_sky.obstacles {
+		pos := MinimumImage(current_sky, o.center, b.position)
+		d, normal := ObstacleSurface(o, pos)
+
+		if d < D {
+			strength := current_sky.avoidanceFactor * (D - d) / D
+			force.x += strength * normal.x
+			force.y += strength * normal.y
+		}
+	}
+
+	return force
+}
+
+// StopAtObstacles returns boid b, which a step moved in a straight line from the position from, stopped just outside
+// the first obstacle surface of current_sky crossed on the way, however thin the obstacle and however long the step.
+// The part of its velocity heading into the obstacle is removed, so that it slides along the obstacle.
+// It acts before the edges of the sky, while the step is still a straight line; ResolveObstacles settles what is left.
+func StopAtObstacles(b Boid, from OrderedPair, current_sky Sky) Boid {
+	margin := 1e-9 * math.Max(current_sky.width, current_sky.height)
+	step := OrderedPair{x: b.position.x - from.x, y: b.position.y - from.y}
+
+	first := math.Inf(1)
+	var normal OrderedPair
+	for _, o := range current_sky.obstacles {
+		// the step as seen from the obstacle, across the edges of a wrapping sky
+		start := MinimumImage(current_sky, o.center, from)
+		if t, n, ok := SegmentEntry(o, start, step); ok && t < first {
+			first, normal = t, n
+		}
+	}
+	if math.IsInf(first, 1) {
+		return b
+	}
+
+	b.position.x = from.x + first*step.x + margin*normal.x
+	b.position.y = from.y + first*step.y + margin*normal.y
+	if v := b.velocity.x*normal.x + b.velocity.y*normal.y; v < 0 {
+		b.velocity.x -= v * normal.x
+		b.velocity.y -= v * normal.y
+	}
+
+	return b
+}
+
+// SegmentEntry returns the fraction t (from 0 to 1) of the segment from start to start+step at which it first enters obstacle o,
+// with the normal of the surface there pointing out of o, and whether it enters o at all.
+// A segment that starts inside o does not enter it.
+func SegmentEntry(o Obstacle, start, step OrderedPair) (float64, OrderedPair, bool) {
+	if d, _ := ObstacleSurface(o, start); d < 0 {
+		return 0, OrderedPair{}, false
+	}
+
+	if o.vertices == nil {
+		// |start + t step - center|² = radius², at the smaller root
+		f := OrderedPair{x: start.x - o.center.x, y: start.y - o.center.y}
+		a := step.x*step.x + step.y*step.y
+		half_b := f.x*step.x + f.y*step.y
+		c := f.x*f.x + f.y*f.y - o.radius*o.radius
+		discriminant := half_b*half_b - a*c
+		if a == 0 || discriminant < 0 {
+			return 0, OrderedPair{}, false
+		}
+		t := (-half_b - math.Sqrt(discriminant)) / a
+		if t < 0 || t > 1 {
+			return 0, OrderedPair{}, false
+		}
+		return t, OrderedPair{x: (f.x + t*step.x) / o.radius, y: (f.y + t*step.y) / o.radius}, true
+	}
+
+	first := math.Inf(1)
+	var normal OrderedPair
+	for i := range o.vertices {
+		a, b := o.vertices[i], o.vertices[(i+1)%len(o.vertices)]
+		edge := OrderedPair{x: b.x - a.x, y: b.y - a.y}
+
+		// start + t step = a + u edge
+		denominator := step.x*edge.y - step.y*edge.x
+		if denominator == 0 {
+			continue
+		}
+		to_a := OrderedPair{x: a.x - start.x, y: a.y - start.y}
+		t := (to_a.x*edge.y - to_a.y*edge.x) / denominator
+		u := (to_a.x*step.y - to_a.y*step.x) / denominator
+		if t < 0 || t > 1 || u < 0 || u > 1 || t >= first {
+			continue
+		}
+
+		// the normal of the edge on the side the segment comes from
+		length := math.Sqrt(edge.x*edge.x + edge.y*edge.y)
+		first, normal = t, OrderedPair{x: -edge.y / length, y: edge.x / length}
+		if normal.x*step.x+normal.y*step.y > 0 {
+			normal.x, normal.y = -normal.x, -normal.y
+		}
+	}
+
+	return first, normal, !math.IsInf(first, 1)
+}
+
+// ResolveObstacles returns boid b moved out of any obstacle of current_sky it is inside:
+// it is put back just outside the nearest surface, and the part of its velocity heading into the obstacle is removed,
+// so that it slides along the obstacle. The push never carries a boid out of a reflecting or soft-walled sky.
+func ResolveObstacles(b Boid, current_sky Sky) Boid {
+	margin := 1e-9 * math.Max(current_sky.width, current_sky.height)
+	before := b.position
+
+	// pushing a boid out of one obstacle may push it into another; a few passes settle overlapping obstacles
+	for pass := 0; pass < 4; pass++ {
+		moved := false
+
+		for _, o := range current_sky.obstacles {
+			pos := MinimumImage(current_sky, o.center, b.position)
+			d, normal := ObstacleSurface(o, pos)
+			if d >= 0 {
+				continue
+			}
+
+			b.position.x += (margin - d) * normal.x
+			b.position.y += (margin - d) * normal.y
+			if v := b.velocity.x*normal.x + b.velocity.y*normal.y; v < 0 {
+				b.velocity.x -= v * normal.x
+				b.velocity.y -= v * normal.y
+			}
+			moved = true
+		}
+
+		if !moved {
+			break
+		}
+	}
+
+	switch current_sky.boundary {
+	case WrapBoundary:
+		b.position.x = WrapCoordinate(b.position.x, current_sky.width)
+		b.position.y = WrapCoordinate(b.position.y, current_sky.height)
+	case ReflectBoundary, SoftWallBoundary:
+		// a boid already outside soft walls may stay there, but no farther out
+		b.position.x = math.Max(math.Min(0, before.x), math.Min(b.position.x, math.Max(current_sky.width, before.x)))
+		b.position.y = math.Max(math.Min(0, before.y), math.Min(b.position.y, math.Max(current_sky.height, before.y)))
+	}
+
+	return b
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestObstacleSurface checks the signed distance and normal outside and inside a circle and a square
+func TestObstacleSurface(t *testing.T) {
+	circle := NewCircleObstacle(OrderedPair{x: 50, y: 50}, 10)
+	square := NewPolygonObstacle([]OrderedPair{{x: 0, y: 0}, {x: 10, y: 0}, {x: 10, y: 10}, {x: 0, y: 10}})
+
+	tests := []struct {
+		name     string
+		o        Obstacle
+		pos      OrderedPair
+		distance float64
+		normal   OrderedPair
+	}{
+		{"outside circle", circle, OrderedPair{x: 65, y: 50}, 5, OrderedPair{x: 1, y: 0}},
+		{"inside circle", circle, OrderedPair{x: 50, y: 44}, -4, OrderedPair{x: 0, y: -1}},
+		{"beside square", square, OrderedPair{x: 13, y: 5}, 3, OrderedPair{x: 1, y: 0}},
+		{"off the corner of square", square, OrderedPair{x: 13, y: 14}, 5, OrderedPair{x: 0.6, y: 0.8}},
+		{"inside square", square, OrderedPair{x: 5, y: 1}, -1, OrderedPair{x: 0, y: -1}},
+	}
+
+	for _, test := range tests {
+		distance, normal := ObstacleSurface(test.o, test.pos)
+		if math.Abs(distance-test.distance) > 1e-12 || math.Abs(normal.x-test.normal.x) > 1e-12 || math.Abs(normal.y-test.normal.y) > 1e-12 {
+			t.Errorf("%s: ObstacleSurface = %v, %v, want %v, %v", test.name, distance, normal, test.distance, test.normal)
+		}
+	}
+}
+
+// TestObstaclesNotPenetrated flies a flock straight at a circle and a triangle and checks that no boid ever ends up inside either
+func TestObstaclesNotPenetrated(t *testing.T) {
+	for _, boundary := range []BoundaryMode{WrapBoundary, ReflectBoundary} {
+		sky := GenerateRandomSky(200, 1000, 1000, 5, 10, 50, 1.5, 0.5, 0.02, 7)
+		sky.boundary = boundary
+		sky.obstacles = []Obstacle{
+			NewCircleObstacle(OrderedPair{x: 500, y: 500}, 120),
+			NewPolygonObstacle([]OrderedPair{{x: 100, y: 100}, {x: 300, y: 120}, {x: 150, y: 320}}),
+		}
+		// weak avoidance, so that boids keep running into the obstacles
+		sky.avoidanceFactor = 0.1
+		sky.avoidanceDistance = 10
+		for i := range sky.boids {
+			sky.boids[i] = ResolveObstacles(sky.boids[i], sky)
+		}
+
+		time_points, err := SimulateBoids(sky, 300, 1.0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for gen, s := range time_points {
+			for _, b := range s.boids {
+				for k, o := range s.obstacles {
+					if d, _ := ObstacleSurface(o, b.position); d < 0 {
+						t.Fatalf("%v sky, generation %d: boid %d is %v inside obstacle %d", boundary, gen, b.id, -d, k)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestObstaclesThinWall flies a boid straight at a wall and a circle thinner than one step, with no avoidance,
+// and checks that it stops in front of each instead of tunnelling through
+func TestObstaclesThinWall(t *testing.T) {
+	for _, o := range []Obstacle{
+		NewPolygonObstacle([]OrderedPair{{x: 50, y: 0}, {x: 51, y: 0}, {x: 51, y: 100}, {x: 50, y: 100}}),
+		NewCircleObstacle(OrderedPair{x: 51, y: 50}, 1),
+	} {
+		for _, boundary := range []BoundaryMode{WrapBoundary, ReflectBoundary} {
+			sky := Sky{width: 100, height: 100, proximity: 10, maxBoidSpeed: 4, boundary: boundary, obstacles: []Obstacle{o}}
+			sky.boids = []Boid{{position: OrderedPair{x: 48, y: 50}, velocity: OrderedPair{x: 4, y: 0}}}
+
+			for gen := 1; gen <= 5; gen++ {
+				sky = UpdateSkyOrFail(t, sky, 1.0, 1)
+				if b := sky.boids[0]; b.position.x >= 50 || b.position.x < 40 {
+					t.Fatalf("%v sky, obstacle %v, generation %d: boid at %v, want it stopped in front of x = 50", boundary, o, gen, b.position)
+				}
+			}
+		}
+	}
+}
+
+// TestResolveObstaclesInsideSky checks that pushing a boid out of an obstacle that overlaps an edge
+// keeps it in a reflecting or soft-walled sky, and leaves a boid already outside soft walls no farther out
+func TestResolveObstaclesInsideSky(t *testing.T) {
+	for _, boundary := range []BoundaryMode{ReflectBoundary, SoftWallBoundary} {
+		sky := Sky{width: 100, height: 100, boundary: boundary}
+		sky.obstacles = []Obstacle{NewCircleObstacle(OrderedPair{x: 3, y: 50}, 10)}
+
+		b := ResolveObstacles(Boid{position: OrderedPair{x: 1, y: 50}, velocity: OrderedPair{x: 1, y: 0}}, sky)
+		if b.position.x < 0 || b.position.x > 100 {
+			t.Errorf("%v sky: boid pushed out of the obstacle to %v, outside the sky", boundary, b.position)
+		}
+		if err := CheckInsideSky(Sky{width: 100, height: 100, boundary: ReflectBoundary, boids: []Boid{b}}); err != nil {
+			t.Errorf("%v sky: %v", boundary, err)
+		}
+	}
+
+	sky := Sky{width: 100, height: 100, boundary: SoftWallBoundary}
+	sky.obstacles = []Obstacle{NewCircleObstacle(OrderedPair{x: -3, y: 50}, 10)}
+	if b := ResolveObstacles(Boid{position: OrderedPair{x: -5, y: 50}}, sky); b.position.x < -5 {
+		t.Errorf("soft-walled sky: boid at x = -5 pushed farther out to %v", b.position)
+	}
+}
+
+// TestObstacleForce checks that the avoidance force points away from a nearby obstacle and vanishes beyond avoidanceDistance
+func TestObstacleForce(t *testing.T) {
+	sky := Sky{width: 100, height: 100, avoidanceFactor: 2, avoidanceDistance: 10}
+	sky.obstacles = []Obstacle{NewCircleObstacle(OrderedPair{x: 95, y: 50}, 10)}
+
+	// across the edge of the wrapping sky the obstacle is 5 away, on the left of the boid
+	force := ComputeObstacleForce(sky, Boid{position: OrderedPair{x: 10, y: 50}})
+	if math.Abs(force.x-1) > 1e-12 || math.Abs(force.y) > 1e-12 {
+		t.Errorf("force across the edge %v, want (1, 0)", force)
+	}
+
+	force = ComputeObstacleForce(sky, Boid{position: OrderedPair{x: 50, y: 50}})
+	if force.x != 0 || force.y != 0 {
+		t.Errorf("force of a distant obstacle %v, want 0", force)
+	}
+}
+
+// TestLoadScene reads a scene file and saves its obstacles in a snapshot that loads back to the same sky
+func TestLoadScene(t *testing.T) {
+	dir := t.TempDir()
+	scene_file := filepath.Join(dir, "scene.json")
+	scene := `{"obstacles": [{"circle": {"center": [500, 500], "radius": 80}}, {"polygon": [[100, 100], [300, 100], [200, 250]]}]}`
+	if err := os.WriteFile(scene_file, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	obstacles, err := LoadScene(scene_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Obstacle{
+		NewCircleObstacle(OrderedPair{x: 500, y: 500}, 80),
+		NewPolygonObstacle([]OrderedPair{{x: 100, y: 100}, {x: 300, y: 100}, {x: 200, y: 250}}),
+	}
+	if !reflect.DeepEqual(obstacles, want) {
+		t.Fatalf("LoadScene = %+v, want %+v", obstacles, want)
+	}
+
+	sky := GenerateRandomSky(10, 1000, 1000, 1, 2, 50, 1, 1, 1, 3)
+	sky.obstacles = obstacles
+	sky.avoidanceFactor, sky.avoidanceDistance = 2, 40
+	for _, name := range []string{"sky.json", "sky.sky"} {
+		filename := filepath.Join(dir, name)
+		if err := SaveSky(filename, sky); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadSky(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded.obstacles, sky.obstacles) || loaded.avoidanceFactor != 2 || loaded.avoidanceDistance != 40 {
+			t.Errorf("%s: loaded obstacles %+v (factor %v, distance %v)", name, loaded.obstacles, loaded.avoidanceFactor, loaded.avoidanceDistance)
+		}
+	}
+
+	bad_scenes := []string{
+		`{"obstacles": [{"circle": {"center": [0, 0], "radius": 0}}]}`,
+		`{"obstacles": [{"polygon": [[0, 0], [1, 1]]}]}`,
+		`{"obstacles": [{}]}`,
+		`{"obstacles": [{"rectangle": [0, 0, 1, 1]}]}`,
+	}
+	for _, bad := range bad_scenes {
+		if err := os.WriteFile(scene_file, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadScene(scene_file); err == nil {
+			t.Errorf("LoadScene accepted %s", bad)
+		}
+	}
+}
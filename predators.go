@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+)
+
+// Predators are a second kind of agent in the sky. Each predator steers toward the boid nearest to it,
+// and boids within fearRadius of a predator flee from it. With a positive catchRadius,
+// a boid that ends a step closer than catchRadius to a predator is caught and removed from the sky.
+
+// AddPredators places num_predators predators at random positions of current_sky, flying in random directions
+// at initial_speed, numbered 0 to num_predators-1. They are drawn from the sky's random generator.
+func AddPredators(current_sky Sky, num_predators int, initial_speed float64) Sky {
+	for i := 0; i < num_predators; i++ {
+		var p Boid
+		p.id = i
+		p.position.x = current_sky.rng.Float64() * current_sky.width
+		p.position.y = current_sky.rng.Float64() * current_sky.height
+
+		angle := current_sky.rng.Float64() * 2 * math.Pi
+		p.velocity.x = initial_speed * math.Cos(angle)
+		p.velocity.y = initial_speed * math.Sin(angle)
+
+		current_sky.predators = append(current_sky.predators, p)
+	}
+
+	return current_sky
+}
+
+// ComputeFleeForce returns the force driving boid b away from the predators of current_sky.
+// Each predator closer than fearRadius pushes b straight away from it, with a strength growing
+// linearly from 0 at fearRadius to fleeFactor when the predator is on top of b.
+func ComputeFleeForce(current_sky Sky, b Boid) OrderedPair {
+	var force OrderedPair
+
+	R := current_sky.fearRadius
+	if R <= 0 {
+		return force
+	}
+
+	for _, p := range current_sky.predators {
+		pos := MinimumImage(current_sky, b.position, p.position)
+		d := Distance(b.position, pos)
+
+		if d > 0 && d < R {
+			strength := current_sky.fleeFactor * (R - d) / R
+			force.x += strength * (b.position.x - pos.x) / d
+			force.y += strength * (b.position.y - pos.y) / d
+		}
+	}
+
+	return force
+}
+
+// NearestBoid returns the index of the boid of current_sky nearest to pos (across the edges of a wrapping sky), or -1 if there are no boids
+func NearestBoid(current_sky Sky, pos OrderedPair) int {
+	nearest := -1
+	nearest_distance := math.Inf(1)
+
+	for i, b := range current_sky.boids {
+		if d := Distance(pos, MinimumImage(current_sky, pos, b.position)); d < nearest_distance {
+			nearest, nearest_distance = i, d
+		}
+	}
+
+	return nearest
+}
+
+// ComputePursuitForce returns the force on predator p: a pull of strength pursuitFactor toward the nearest boid,
+// plus the push of soft walls and obstacles that boids feel too
+func ComputePursuitForce(current_sky Sky, p Boid) OrderedPair {
+	var force OrderedPair
+
+	if i := NearestBoid(current_sky, p.position); i >= 0 {
+		target := MinimumImage(current_sky, p.position, current_sky.boids[i].position)
+		if d := Distance(p.position, target); d > 0 {
+			force.x = current_sky.pursuitFactor * (target.x - p.position.x) / d
+			force.y = current_sky.pursuitFactor * (target.y - p.position.y) / d
+		}
+	}
+
+	wall_force := ComputeWallForce(current_sky, p)
+	force.x += wall_force.x
+	force.y += wall_force.y
+
+	obstacle_force := ComputeObstacleForce(current_sky, p)
+	force.x += obstacle_force.x
+	force.y += obstacle_force.y
+
+	return force
+}
+
+// UpdatePredators moves the predators of new_sky (a copy of current_sky) forward by one time step,
+// chasing the boids of current_sky, with the integrator of the boids but limited to maxPredatorSpeed.
+// The boids stay where they are in current_sky for every force evaluation of the step.
+func UpdatePredators(current_sky, new_sky Sky, time_step float64) {
+	if len(current_sky.predators) == 0 {
+		return
+	}
+
+	pursuit := func(predators []Boid, start bool) []OrderedPair {
+		accelerations := make([]OrderedPair, len(predators))
+		for i, p := range predators {
+			accelerations[i] = ComputePursuitForce(current_sky, p)
+		}
+		return accelerations
+	}
+	max_speed := func(p Boid) float64 {
+		return current_sky.maxPredatorSpeed
+	}
+
+	stepped := SkyIntegrator(current_sky).Step(current_sky.predators, pursuit, max_speed, time_step)
+	for i := range stepped {
+		new_sky.predators[i] = StopAtObstacles(stepped[i], current_sky.predators[i].position, current_sky)
+		new_sky.predators[i] = ApplyBoundary(new_sky.predators[i], current_sky)
+		new_sky.predators[i] = ResolveObstacles(new_sky.predators[i], current_sky)
+	}
+}
+
+// CatchBoids removes from new_sky the boids closer than catchRadius to a predator and adds them to its captures.
+// The boids left keep their order and ids.
+func CatchBoids(new_sky Sky) Sky {
+	if new_sky.catchRadius <= 0 || len(new_sky.predators) == 0 {
+		return new_sky
+	}
+
+	kept := new_sky.boids[:0]
+	for _, b := range new_sky.boids {
+		caught := false
+		for _, p := range new_sky.predators {
+			if Distance(b.position, MinimumImage(new_sky, b.position, p.position)) < new_sky.catchRadius {
+				caught = true
+				break
+			}
+		}
+
+		if caught {
+			new_sky.captures++
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	new_sky.boids = kept
+
+	return new_sky
+}
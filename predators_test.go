@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestComputeFleeForce checks that a boid flees a predator just across the edge of the sky, and ignores one beyond fearRadius
+func TestComputeFleeForce(t *testing.T) {
+	sky := Sky{width: 100, height: 100, fearRadius: 20, fleeFactor: 2}
+	sky.predators = []Boid{{position: OrderedPair{x: 50, y: 95}}, {position: OrderedPair{x: 10, y: 50}}}
+
+	// the first predator is 10 away, above the boid through the top edge; the second is 40 away
+	force := ComputeFleeForce(sky, Boid{position: OrderedPair{x: 50, y: 5}})
+	if math.Abs(force.x) > 1e-12 || math.Abs(force.y-1) > 1e-12 {
+		t.Errorf("ComputeFleeForce = %v, want (0, 1)", force)
+	}
+
+	sky.fearRadius = 0
+	if force := ComputeFleeForce(sky, Boid{position: OrderedPair{x: 50, y: 5}}); force.x != 0 || force.y != 0 {
+		t.Errorf("ComputeFleeForce without fear = %v, want 0", force)
+	}
+}
+
+// TestComputePursuitForce checks that a predator is pulled toward its nearest boid, across the edge of a wrapping sky
+func TestComputePursuitForce(t *testing.T) {
+	sky := Sky{width: 100, height: 100, pursuitFactor: 0.5}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}},
+		{id: 1, position: OrderedPair{x: 97, y: 10}},
+	}
+
+	force := ComputePursuitForce(sky, Boid{position: OrderedPair{x: 3, y: 10}})
+	if math.Abs(force.x+0.5) > 1e-12 || math.Abs(force.y) > 1e-12 {
+		t.Errorf("ComputePursuitForce = %v, want (-0.5, 0)", force)
+	}
+
+	sky.boundary = ReflectBoundary
+	force = ComputePursuitForce(sky, Boid{position: OrderedPair{x: 3, y: 10}})
+	if !(force.x > 0 && force.y > 0) {
+		t.Errorf("ComputePursuitForce on a reflecting sky = %v, want a pull toward (50, 50)", force)
+	}
+}
+
+// TestCatchBoids checks that only the boids within catchRadius of a predator are removed, and that they are counted
+func TestCatchBoids(t *testing.T) {
+	sky := Sky{width: 100, height: 100, catchRadius: 5, captures: 1}
+	sky.predators = []Boid{{position: OrderedPair{x: 1, y: 1}}}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 98, y: 99}},
+		{id: 1, position: OrderedPair{x: 50, y: 50}},
+		{id: 2, position: OrderedPair{x: 4, y: 1}},
+		{id: 3, position: OrderedPair{x: 7, y: 1}},
+	}
+
+	sky = CatchBoids(sky)
+	if sky.captures != 3 || len(sky.boids) != 2 || sky.boids[0].id != 1 || sky.boids[1].id != 3 {
+		t.Errorf("CatchBoids left boids %v with %d captures, want boids 1 and 3 with 3 captures", sky.boids, sky.captures)
+	}
+}
+
+// TestPredatorsHunt runs a flock with predators and checks that predators keep to their speed limit,
+// that boids are caught and counted, and that the parallel update agrees with the serial one
+func TestPredatorsHunt(t *testing.T) {
+	sky := GenerateRandomSky(100, 500, 500, 1.0, 2.0, 60, 1.5, 1.0, 0.02, 5)
+	sky = AddPredators(sky, 3, 1.0)
+	sky.maxPredatorSpeed, sky.pursuitFactor = 3, 0.5
+	sky.fearRadius, sky.fleeFactor = 100, 2
+	sky.catchRadius = 10
+
+	serial_sky, parallel_sky := sky, sky
+	for gen := 1; gen <= 200; gen++ {
+		serial_sky = UpdateSkyOrFail(t, serial_sky, 1.0, 1)
+		parallel_sky = UpdateSkyOrFail(t, parallel_sky, 1.0, 4)
+
+		for _, p := range serial_sky.predators {
+			if speed := math.Sqrt(p.velocity.x*p.velocity.x + p.velocity.y*p.velocity.y); speed > 3+1e-12 {
+				t.Fatalf("generation %d: predator %d flies at %v, faster than 3", gen, p.id, speed)
+			}
+		}
+		if len(serial_sky.boids)+serial_sky.captures != 100 {
+			t.Fatalf("generation %d: %d boids left and %d caught, want 100 in all", gen, len(serial_sky.boids), serial_sky.captures)
+		}
+	}
+
+	if serial_sky.captures == 0 {
+		t.Errorf("no boid caught in 200 generations")
+	}
+	if !reflect.DeepEqual(MakeSkySnapshot(serial_sky), MakeSkySnapshot(parallel_sky)) {
+		t.Errorf("UpdateSkyParallel with predators differs from UpdateSky")
+	}
+}
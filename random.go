@@ -0,0 +1,54 @@
+package main
+
+import "math/rand"
+
+// SeededRand is the random generator of one simulation. It draws the same values as
+// rand.New(rand.NewSource(seed)), but also counts them, so that its state can be written
+// to a checkpoint as (seed, draws) and restored exactly.
+type SeededRand struct {
+	*rand.Rand
+	seed   int64
+	source *countingSource
+}
+
+// countingSource wraps the standard math/rand source and counts the values taken from it.
+// Every Int63 or Uint64 call advances the standard source by exactly one step.
+type countingSource struct {
+	src   rand.Source64
+	draws uint64
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.draws = 0
+}
+
+// NewSeededRand returns a generator seeded with seed
+func NewSeededRand(seed int64) *SeededRand {
+	source := &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+	return &SeededRand{Rand: rand.New(source), seed: seed, source: source}
+}
+
+// RandState returns the seed of rng and the number of values drawn from it so far
+func RandState(rng *SeededRand) (int64, uint64) {
+	return rng.seed, rng.source.draws
+}
+
+// RestoreSeededRand returns a generator in the state described by RandState
+func RestoreSeededRand(seed int64, draws uint64) *SeededRand {
+	rng := NewSeededRand(seed)
+	for i := uint64(0); i < draws; i++ {
+		rng.source.Uint64()
+	}
+	return rng
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Neighbor is a boid as seen by the boid being steered
+type Neighbor struct {
+	Boid     Boid    // the neighbor, at its periodic image nearest to the steered boid on a wrapping sky
+	Distance float64 // distance between the two boids, never 0 for a rule (ComputeNetForce leaves out boids at the same position)
+	Factor   float64 // strength of the rule between the species of the two boids (the rule's factor in the sky, or 1)
+}
+
+// Rule is a steering rule: given boid b and the neighbors it sees for this rule, it returns the force the rule puts on b.
+// ComputeNetForce adds up the forces of the enabled rules, each multiplied by its weight.
+type Rule interface {
+	Force(b Boid, neighbors []Neighbor) OrderedPair
+}
+
+// RuleSetting enables or disables a registered rule and sets its weight
+type RuleSetting struct {
+	Name    string  `json:"name"`
+	Weight  float64 `json:"weight"`
+	Enabled bool    `json:"enabled"`
+}
+
+// the registered rules by name, and their names in the order they were registered
+var (
+	ruleRegistry = map[string]Rule{}
+	ruleNames    []string
+)
+
+func init() {
+	RegisterRule("separation", SeparationRule{})
+	RegisterRule("alignment", AlignmentRule{})
+	RegisterRule("cohesion", CohesionRule{})
+}
+
+// RegisterRule makes rule available under name to -rules and run files. Registering a name twice panics.
+func RegisterRule(name string, rule Rule) {
+	if _, exists := ruleRegistry[name]; exists {
+		panic("rule " + name + " registered twice")
+	}
+	ruleRegistry[name] = rule
+	ruleNames = append(ruleNames, name)
+}
+
+// RuleNames returns the names of the registered rules, in the order they were registered
+func RuleNames() []string {
+	return append([]string(nil), ruleNames...)
+}
+
+// DefaultRules returns the classic rules, separation, alignment and cohesion, enabled with weight 1
+func DefaultRules() []RuleSetting {
+	return []RuleSetting{
+		{Name: "separation", Weight: 1, Enabled: true},
+		{Name: "alignment", Weight: 1, Enabled: true},
+		{Name: "cohesion", Weight: 1, Enabled: true},
+	}
+}
+
+// SkyRules returns the rule settings of current_sky; a sky without settings follows DefaultRules
+func SkyRules(current_sky Sky) []RuleSetting {
+	if current_sky.rules == nil {
+		return DefaultRules()
+	}
+	return current_sky.rules
+}
+
+// ParseRules reads the -rules flag: a comma-separated list of the enabled rules, each optionally followed by :weight,
+// as in "separation,alignment:0.5". The registered rules left out are disabled.
+func ParseRules(s string) ([]RuleSetting, error) {
+	settings := []RuleSetting{}
+	listed := map[string]bool{}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		name, weight_string, has_weight := strings.Cut(field, ":")
+		weight := 1.0
+		if has_weight {
+			var err error
+			if weight, err = strconv.ParseFloat(weight_string, 64); err != nil {
+				return nil, fmt.Errorf("weight of rule %s: %w", name, err)
+			}
+		}
+		if _, ok := ruleRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown rule %q (want one of %s)", name, strings.Join(ruleNames, ", "))
+		}
+
+		settings = append(settings, RuleSetting{Name: name, Weight: weight, Enabled: true})
+		listed[name] = true
+	}
+
+	for _, name := range ruleNames {
+		if !listed[name] {
+			settings = append(settings, RuleSetting{Name: name, Weight: 1})
+		}
+	}
+
+	return settings, nil
+}
+
+// FormatRules writes the enabled rules of settings in the form read by ParseRules
+func FormatRules(settings []RuleSetting) string {
+	var fields []string
+	for _, setting := range settings {
+		if setting.Enabled {
+			fields = append(fields, setting.Name+":"+FormatFloat(setting.Weight))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// ValidateRules checks that every rule of settings is registered, appears once, and has a finite weight
+func ValidateRules(settings []RuleSetting) error {
+	seen := map[string]bool{}
+
+	for _, setting := range settings {
+		if _, ok := ruleRegistry[setting.Name]; !ok {
+			return fmt.Errorf("unknown rule %q (want one of %s)", setting.Name, strings.Join(ruleNames, ", "))
+		}
+		if seen[setting.Name] {
+			return fmt.Errorf("rule %s is set twice", setting.Name)
+		}
+		seen[setting.Name] = true
+		if math.IsNaN(setting.Weight) || math.IsInf(setting.Weight, 0) {
+			return fmt.Errorf("weight of rule %s must be finite, got %v", setting.Name, setting.Weight)
+		}
+	}
+
+	return nil
+}
+
+// RuleFactor returns the Factor of a neighbor of species other for rule name acting on a boid of species s:
+// the species-weighted separation, alignment or cohesion factor for the classic rules, and 1 for any other rule
+func RuleFactor(current_sky Sky, name string, s, other int) float64 {
+	S, A, C, _ := InteractionFactors(current_sky, s, other)
+
+	switch name {
+	case "separation":
+		return S
+	case "alignment":
+		return A
+	case "cohesion":
+		return C
+	default:
+		return 1
+	}
+}
+
+// RuleAngle returns the width in degrees of the vision cone of rule name: the classic rules have their own angles,
+// and any other rule sees within the shared angle (narrowed by the blind spot)
+func RuleAngle(vision Vision, name string) float64 {
+	separation, alignment, cohesion := RuleAngles(vision)
+
+	switch name {
+	case "separation":
+		return separation
+	case "alignment":
+		return alignment
+	case "cohesion":
+		return cohesion
+	default:
+		return ConeAngle(vision, 0)
+	}
+}
+
+// AverageForce returns the mean of force over neighbors (0 without neighbors)
+func AverageForce(neighbors []Neighbor, force func(n Neighbor) OrderedPair) OrderedPair {
+	var total OrderedPair
+
+	for _, n := range neighbors {
+		f := force(n)
+		total.x += f.x
+		total.y += f.y
+	}
+
+	if len(neighbors) > 0 {
+		total.x /= float64(len(neighbors))
+		total.y /= float64(len(neighbors))
+	}
+
+	return total
+}
+
+// SeparationRule steers a boid away from its neighbors, more strongly the closer they are
+type SeparationRule struct{}
+
+// Force returns the mean separation force of the neighbors
+func (SeparationRule) Force(b Boid, neighbors []Neighbor) OrderedPair {
+	return AverageForce(neighbors, func(n Neighbor) OrderedPair {
+		return ComputeSeparationForce(b, n.Boid, n.Factor, n.Distance)
+	})
+}
+
+// AlignmentRule steers a boid toward the velocity of its neighbors
+type AlignmentRule struct{}
+
+// Force returns the mean alignment force of the neighbors
+func (AlignmentRule) Force(b Boid, neighbors []Neighbor) OrderedPair {
+	return AverageForce(neighbors, func(n Neighbor) OrderedPair {
+		return ComputeAlignmentForce(b, n.Boid, n.Factor, n.Distance)
+	})
+}
+
+// CohesionRule steers a boid toward its neighbors
+type CohesionRule struct{}
+
+// Force returns the mean cohesion force of the neighbors
+func (CohesionRule) Force(b Boid, neighbors []Neighbor) OrderedPair {
+	return AverageForce(neighbors, func(n Neighbor) OrderedPair {
+		return ComputeCohesionForce(b, n.Boid, n.Factor, n.Distance)
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// RuleTest runs a rule on its own, with the boid and neighbors of a test case, and compares the force with the expected one
+type RuleTest struct {
+	name      string
+	b         Boid
+	neighbors []Neighbor
+	result    OrderedPair
+}
+
+// RunRuleTests checks each test against the rule registered under its name
+func RunRuleTests(t *testing.T, tests []RuleTest, epsilon float64) {
+	t.Helper()
+
+	for _, test := range tests {
+		result := ruleRegistry[test.name].Force(test.b, test.neighbors)
+
+		if math.Abs(result.x-test.result.x) > epsilon || math.Abs(result.y-test.result.y) > epsilon {
+			t.Errorf("%s rule (position: %v, velocity: %v, neighbors: %+v) = %v, want %v",
+				test.name, test.b.position, test.b.velocity, test.neighbors, result, test.result)
+		}
+	}
+}
+
+// ReadRuleTests turns the single-neighbor tests of a force function into tests of the rule name,
+// with the rule's factor taken from each test
+func ReadRuleTests(directory, name string) []RuleTest {
+	var tests []RuleTest
+
+	for _, test := range ReadComputeForceTests(directory) {
+		factor := map[string]float64{"separation": test.separation_factor, "alignment": test.align_factor, "cohesion": test.cohesion_factor}[name]
+		neighbor := Boid{position: test.b2_pos, velocity: test.b2_vel}
+
+		tests = append(tests, RuleTest{
+			name:      name,
+			b:         Boid{position: test.b1_pos},
+			neighbors: []Neighbor{{Boid: neighbor, Distance: Distance(test.b1_pos, test.b2_pos), Factor: factor}},
+			result:    test.result,
+		})
+	}
+
+	return tests
+}
+
+// TestClassicRules checks the separation, alignment and cohesion rules in isolation,
+// against the tests of their force functions
+func TestClassicRules(t *testing.T) {
+	RunRuleTests(t, ReadRuleTests("Tests/ComputeSeparationForce/", "separation"), 1e-2)
+	RunRuleTests(t, ReadRuleTests("Tests/ComputeAlignmentForce/", "alignment"), 1e-2)
+	RunRuleTests(t, ReadRuleTests("Tests/ComputeCohesionForce/", "cohesion"), 1e-2)
+}
+
+// TestRulesAverage checks that every classic rule gives no force without neighbors,
+// and averages its force over the neighbors it is given
+func TestRulesAverage(t *testing.T) {
+	b := Boid{position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}}
+	near := Neighbor{Boid: Boid{position: OrderedPair{x: 53, y: 54}, velocity: OrderedPair{x: 0, y: 1}}, Distance: 5, Factor: 1}
+	far := Neighbor{Boid: Boid{position: OrderedPair{x: 44, y: 42}, velocity: OrderedPair{x: -1, y: 0}}, Distance: 10, Factor: 2}
+
+	for _, name := range []string{"separation", "alignment", "cohesion"} {
+		rule := ruleRegistry[name]
+
+		if result := rule.Force(b, nil); result != (OrderedPair{}) {
+			t.Errorf("%s rule without neighbors = %v, want 0", name, result)
+		}
+
+		f1, f2 := rule.Force(b, []Neighbor{near}), rule.Force(b, []Neighbor{far})
+		want := OrderedPair{x: (f1.x + f2.x) / 2, y: (f1.y + f2.y) / 2}
+		RunRuleTests(t, []RuleTest{{name: name, b: b, neighbors: []Neighbor{near, far}, result: want}}, 1e-12)
+	}
+}
+
+// headingRule pushes a boid along +x with the mean factor of its neighbors, to test rules added to the registry
+type headingRule struct{}
+
+func (headingRule) Force(b Boid, neighbors []Neighbor) OrderedPair {
+	return AverageForce(neighbors, func(n Neighbor) OrderedPair {
+		return OrderedPair{x: n.Factor}
+	})
+}
+
+// TestComputeNetForceRules checks that ComputeNetForce adds up the enabled rules with their weights,
+// including a rule registered outside rules.go
+func TestComputeNetForceRules(t *testing.T) {
+	if _, ok := ruleRegistry["heading"]; !ok {
+		RegisterRule("heading", headingRule{})
+	}
+
+	sky := Sky{width: 100, height: 100, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+		{id: 1, position: OrderedPair{x: 53, y: 54}, velocity: OrderedPair{x: 0, y: 1}},
+	}
+	b, other := sky.boids[0], sky.boids[1]
+	s := ComputeSeparationForce(b, other, 1.5, 5)
+	c := ComputeCohesionForce(b, other, 0.2, 5)
+
+	// the default rules give the classic forces
+	classic := ComputeNetForce(sky, b)
+	sky.rules = DefaultRules()
+	if result := ComputeNetForce(sky, b); result != classic {
+		t.Errorf("ComputeNetForce with DefaultRules = %v, want %v", result, classic)
+	}
+
+	rules, err := ParseRules("separation:2, cohesion, heading:0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sky.rules = rules
+	want := OrderedPair{x: 2*s.x + c.x + 0.5, y: 2*s.y + c.y}
+	if result := ComputeNetForce(sky, b); math.Abs(result.x-want.x) > 1e-12 || math.Abs(result.y-want.y) > 1e-12 {
+		t.Errorf("ComputeNetForce with rules %q = %v, want %v", FormatRules(rules), result, want)
+	}
+
+	// all rules disabled
+	sky.rules = []RuleSetting{}
+	if result := ComputeNetForce(sky, b); result != (OrderedPair{}) {
+		t.Errorf("ComputeNetForce without rules = %v, want 0", result)
+	}
+}
+
+// TestParseRules checks the -rules flag and the errors of ValidateRules
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("alignment:0.5,separation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != len(RuleNames()) || rules[0] != (RuleSetting{Name: "alignment", Weight: 0.5, Enabled: true}) ||
+		rules[1] != (RuleSetting{Name: "separation", Weight: 1, Enabled: true}) || rules[2] != (RuleSetting{Name: "cohesion", Weight: 1}) {
+		t.Errorf("ParseRules = %+v", rules)
+	}
+	if s := FormatRules(rules); s != "alignment:0.5,separation:1" {
+		t.Errorf("FormatRules = %q, want %q", s, "alignment:0.5,separation:1")
+	}
+
+	for _, s := range []string{"flocking", "cohesion:much", "separation,separation"} {
+		rules, err := ParseRules(s)
+		if err == nil {
+			err = ValidateRules(rules)
+		}
+		if err == nil {
+			t.Errorf("rules %q were accepted", s)
+		}
+	}
+
+	if err := ValidateRules([]RuleSetting{{Name: "cohesion", Weight: math.Inf(1), Enabled: true}}); err == nil {
+		t.Errorf("ValidateRules accepted an infinite weight")
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// SkySnapshot is the serializable form of a Sky: its parameters and the position, velocity and acceleration of every boid.
+// Loading a snapshot gives back exactly the same Sky (the random generator is not part of it).
+type SkySnapshot struct {
+	Width             float64            `json:"width"`
+	Height            float64            `json:"height"`
+	Proximity         float64            `json:"proximity"`
+	SeparationFactor  float64            `json:"separationFactor"`
+	AlignmentFactor   float64            `json:"alignmentFactor"`
+	CohesionFactor    float64            `json:"cohesionFactor"`
+	MaxBoidSpeed      float64            `json:"maxBoidSpeed"`
+	Boundary          BoundaryMode       `json:"boundary"`
+	WallMargin        float64            `json:"wallMargin"`
+	WallFactor        float64            `json:"wallFactor"`
+	NeighborMode      NeighborMode       `json:"neighborMode"`
+	NumNeighbors      int                `json:"numNeighbors"`
+	Vision            Vision             `json:"vision"`
+	Rules             []RuleSetting      `json:"rules,omitempty"`
+	Model             ForceModel         `json:"model"`
+	MaxForce          float64            `json:"maxForce"`
+	Noise             float64            `json:"noise"`
+	Integrator        IntegrationScheme  `json:"integrator"`
+	Species           []Species          `json:"species,omitempty"`
+	Obstacles         []ObstacleSnapshot `json:"obstacles,omitempty"`
+	AvoidanceFactor   float64            `json:"avoidanceFactor"`
+	AvoidanceDistance float64            `json:"avoidanceDistance"`
+	Predators         []BoidSnapshot     `json:"predators,omitempty"`
+	MaxPredatorSpeed  float64            `json:"maxPredatorSpeed"`
+	PursuitFactor     float64            `json:"pursuitFactor"`
+	FearRadius        float64            `json:"fearRadius"`
+	FleeFactor        float64            `json:"fleeFactor"`
+	CatchRadius       float64            `json:"catchRadius"`
+	Captures          int                `json:"captures"`
+	Boids             []BoidSnapshot     `json:"boids,omitempty"`
+}
+
+// BoidSnapshot is the serializable form of a Boid, with each vector stored as [x, y].
+type BoidSnapshot struct {
+	ID           int        `json:"id"`
+	Species      int        `json:"species,omitempty"`
+	Position     [2]float64 `json:"position"`
+	Velocity     [2]float64 `json:"velocity"`
+	Acceleration [2]float64 `json:"acceleration"`
+}
+
+// The binary format starts with skyMagic and the format version, followed by the length-prefixed JSON of the
+// sky parameters (and predators), the number of boids, and for each boid its id and species as little-endian int64 and six little-endian float64
+// (position, velocity and acceleration, x before y).
+const (
+	skyMagic         = "BOIDSKY\x00"
+	skyBinaryVersion = 1
+)
+
+// MakeSkySnapshot returns the snapshot of current_sky
+func MakeSkySnapshot(current_sky Sky) SkySnapshot {
+	snapshot := SkySnapshot{
+		Width:             current_sky.width,
+		Height:            current_sky.height,
+		Proximity:         current_sky.proximity,
+		SeparationFactor:  current_sky.separationFactor,
+		AlignmentFactor:   current_sky.alignmentFactor,
+		CohesionFactor:    current_sky.cohesionFactor,
+		MaxBoidSpeed:      current_sky.maxBoidSpeed,
+		Boundary:          current_sky.boundary,
+		WallMargin:        current_sky.wallMargin,
+		WallFactor:        current_sky.wallFactor,
+		NeighborMode:      current_sky.neighborMode,
+		NumNeighbors:      current_sky.numNeighbors,
+		Vision:            current_sky.vision,
+		Rules:             current_sky.rules,
+		Model:             current_sky.model,
+		MaxForce:          current_sky.maxForce,
+		Noise:             current_sky.noise,
+		Integrator:        current_sky.integrator,
+		Species:           current_sky.species,
+		Obstacles:         ObstacleSnapshots(current_sky.obstacles),
+		AvoidanceFactor:   current_sky.avoidanceFactor,
+		AvoidanceDistance: current_sky.avoidanceDistance,
+		MaxPredatorSpeed:  current_sky.maxPredatorSpeed,
+		PursuitFactor:     current_sky.pursuitFactor,
+		FearRadius:        current_sky.fearRadius,
+		FleeFactor:        current_sky.fleeFactor,
+		CatchRadius:       current_sky.catchRadius,
+		Captures:          current_sky.captures,
+		Boids:             make([]BoidSnapshot, len(current_sky.boids)),
+	}
+
+	for i, b := range current_sky.boids {
+		snapshot.Boids[i] = MakeBoidSnapshot(b)
+	}
+	for _, p := range current_sky.predators {
+		snapshot.Predators = append(snapshot.Predators, MakeBoidSnapshot(p))
+	}
+
+	return snapshot
+}
+
+// MakeBoidSnapshot returns the snapshot of boid b
+func MakeBoidSnapshot(b Boid) BoidSnapshot {
+	return BoidSnapshot{
+		ID:           b.id,
+		Species:      b.species,
+		Position:     [2]float64{b.position.x, b.position.y},
+		Velocity:     [2]float64{b.velocity.x, b.velocity.y},
+		Acceleration: [2]float64{b.acceleration.x, b.acceleration.y},
+	}
+}
+
+// BoidFromSnapshot rebuilds the Boid stored in snapshot
+func BoidFromSnapshot(snapshot BoidSnapshot) Boid {
+	var b Boid
+
+	b.id = snapshot.ID
+	b.species = snapshot.Species
+	b.position = OrderedPair{x: snapshot.Position[0], y: snapshot.Position[1]}
+	b.velocity = OrderedPair{x: snapshot.Velocity[0], y: snapshot.Velocity[1]}
+	b.acceleration = OrderedPair{x: snapshot.Acceleration[0], y: snapshot.Acceleration[1]}
+
+	return b
+}
+
+// SkyFromSnapshot rebuilds the Sky stored in snapshot
+func SkyFromSnapshot(snapshot SkySnapshot) Sky {
+	var new_sky Sky
+
+	new_sky.width = snapshot.Width
+	new_sky.height = snapshot.Height
+	new_sky.proximity = snapshot.Proximity
+	new_sky.separationFactor = snapshot.SeparationFactor
+	new_sky.alignmentFactor = snapshot.AlignmentFactor
+	new_sky.cohesionFactor = snapshot.CohesionFactor
+	new_sky.maxBoidSpeed = snapshot.MaxBoidSpeed
+	new_sky.boundary = snapshot.Boundary
+	new_sky.wallMargin = snapshot.WallMargin
+	new_sky.wallFactor = snapshot.WallFactor
+	new_sky.neighborMode = snapshot.NeighborMode
+	new_sky.numNeighbors = snapshot.NumNeighbors
+	new_sky.vision = snapshot.Vision
+	new_sky.rules = snapshot.Rules
+	new_sky.model = snapshot.Model
+	new_sky.maxForce = snapshot.MaxForce
+	new_sky.noise = snapshot.Noise
+	new_sky.integrator = snapshot.Integrator
+	new_sky.species = snapshot.Species
+	new_sky.avoidanceFactor = snapshot.AvoidanceFactor
+	new_sky.avoidanceDistance = snapshot.AvoidanceDistance
+	for _, o := range snapshot.Obstacles {
+		new_sky.obstacles = append(new_sky.obstacles, ObstacleFromSnapshot(o))
+	}
+	new_sky.maxPredatorSpeed = snapshot.MaxPredatorSpeed
+	new_sky.pursuitFactor = snapshot.PursuitFactor
+	new_sky.fearRadius = snapshot.FearRadius
+	new_sky.fleeFactor = snapshot.FleeFactor
+	new_sky.catchRadius = snapshot.CatchRadius
+	new_sky.captures = snapshot.Captures
+	for _, p := range snapshot.Predators {
+		new_sky.predators = append(new_sky.predators, BoidFromSnapshot(p))
+	}
+	new_sky.boids = make([]Boid, len(snapshot.Boids))
+
+	// snapshots written before boids had ids give every boid id 0; number those boids in order instead
+	numbered := false
+	for _, b := range snapshot.Boids {
+		numbered = numbered || b.ID != 0
+	}
+
+	for i, b := range snapshot.Boids {
+		new_sky.boids[i] = BoidFromSnapshot(b)
+		if !numbered {
+			new_sky.boids[i].id = i
+		}
+	}
+
+	return new_sky
+}
+
+// SaveSky writes current_sky to filename, as JSON if the name ends in .json and in the binary format otherwise
+func SaveSky(filename string, current_sky Sky) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if filepath.Ext(filename) == ".json" {
+		err = WriteSkyJSON(w, current_sky)
+	} else {
+		err = WriteSkyBinary(w, current_sky)
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+
+	return err
+}
+
+// LoadSky reads a sky saved by SaveSky, recognizing the format from the file contents
+func LoadSky(filename string) (Sky, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Sky{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(len(skyMagic))
+
+	var loaded_sky Sky
+	if string(magic) == skyMagic {
+		loaded_sky, err = ReadSkyBinary(r)
+	} else {
+		loaded_sky, err = ReadSkyJSON(r)
+	}
+	if err != nil {
+		return Sky{}, fmt.Errorf("reading sky %s: %w", filename, err)
+	}
+
+	return loaded_sky, nil
+}
+
+// WriteSkyJSON writes current_sky to w as an indented JSON SkySnapshot
+func WriteSkyJSON(w io.Writer, current_sky Sky) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(MakeSkySnapshot(current_sky))
+}
+
+// ReadSkyJSON reads a sky written by WriteSkyJSON
+func ReadSkyJSON(r io.Reader) (Sky, error) {
+	var snapshot SkySnapshot
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&snapshot); err != nil {
+		return Sky{}, err
+	}
+
+	return SkyFromSnapshot(snapshot), nil
+}
+
+// WriteSkyBinary writes current_sky to w in the compact binary format
+func WriteSkyBinary(w io.Writer, current_sky Sky) error {
+	snapshot := MakeSkySnapshot(current_sky)
+	boids := snapshot.Boids
+	snapshot.Boids = nil
+
+	header, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, skyMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, [2]uint32{skyBinaryVersion, uint32(len(header))}); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(boids))); err != nil {
+		return err
+	}
+
+	record := make([]byte, 8*8)
+	for _, b := range boids {
+		binary.LittleEndian.PutUint64(record, uint64(int64(b.ID)))
+		binary.LittleEndian.PutUint64(record[8:], uint64(int64(b.Species)))
+		values := [6]float64{b.Position[0], b.Position[1], b.Velocity[0], b.Velocity[1], b.Acceleration[0], b.Acceleration[1]}
+		for k, v := range values {
+			binary.LittleEndian.PutUint64(record[8*(k+2):], math.Float64bits(v))
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadSkyBinary reads a sky written by WriteSkyBinary
+func ReadSkyBinary(r io.Reader) (Sky, error) {
+	magic := make([]byte, len(skyMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return Sky{}, err
+	}
+	if string(magic) != skyMagic {
+		return Sky{}, errors.New("not a binary sky file")
+	}
+
+	var version_and_length [2]uint32
+	if err := binary.Read(r, binary.LittleEndian, &version_and_length); err != nil {
+		return Sky{}, err
+	}
+	version := version_and_length[0]
+	if version != skyBinaryVersion {
+		return Sky{}, fmt.Errorf("unsupported binary sky version %d", version)
+	}
+
+	header := make([]byte, version_and_length[1])
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Sky{}, err
+	}
+
+	var snapshot SkySnapshot
+	decoder := json.NewDecoder(bytes.NewReader(header))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&snapshot); err != nil {
+		return Sky{}, err
+	}
+
+	var num_boids uint64
+	if err := binary.Read(r, binary.LittleEndian, &num_boids); err != nil {
+		return Sky{}, err
+	}
+
+	record := make([]byte, 8*8)
+	for i := uint64(0); i < num_boids; i++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return Sky{}, err
+		}
+
+		var values [6]float64
+		for k := range values {
+			values[k] = math.Float64frombits(binary.LittleEndian.Uint64(record[8*(k+2):]))
+		}
+		snapshot.Boids = append(snapshot.Boids, BoidSnapshot{
+			ID:           int(int64(binary.LittleEndian.Uint64(record))),
+			Species:      int(int64(binary.LittleEndian.Uint64(record[8:]))),
+			Position:     [2]float64{values[0], values[1]},
+			Velocity:     [2]float64{values[2], values[3]},
+			Acceleration: [2]float64{values[4], values[5]},
+		})
+	}
+
+	return SkyFromSnapshot(snapshot), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSaveLoadSky checks that both snapshot formats give back exactly the saved sky
+func TestSaveLoadSky(t *testing.T) {
+	saved_sky := GenerateRandomSky(30, 1000, 400, 1.0, 2.0, 100, 1.5, 1.0, 0.02, 3)
+	saved_sky = AddPredators(saved_sky, 2, 1.0)
+	saved_sky.maxPredatorSpeed, saved_sky.pursuitFactor, saved_sky.fearRadius, saved_sky.fleeFactor = 3, 0.5, 150, 2
+	saved_sky.catchRadius, saved_sky.captures = 10, 4
+	saved_sky = UpdateSkyOrFail(t, saved_sky, 1.0, 1) // nonzero accelerations
+	saved_sky.boundary = SoftWallBoundary
+	saved_sky.wallMargin, saved_sky.wallFactor = 50, 0.5
+	saved_sky.boids[0].velocity = OrderedPair{x: math.Copysign(0, -1), y: 1.0 / 3.0}
+	saved_sky.boids[1].position = OrderedPair{x: math.SmallestNonzeroFloat64, y: math.MaxFloat64}
+
+	for _, name := range []string{"sky.json", "sky.sky"} {
+		filename := filepath.Join(t.TempDir(), name)
+		if err := SaveSky(filename, saved_sky); err != nil {
+			t.Fatalf("SaveSky(%s): %v", name, err)
+		}
+
+		loaded_sky, err := LoadSky(filename)
+		if err != nil {
+			t.Fatalf("LoadSky(%s): %v", name, err)
+		}
+
+		if !reflect.DeepEqual(MakeSkySnapshot(loaded_sky), MakeSkySnapshot(saved_sky)) {
+			t.Errorf("LoadSky(%s) = %+v, want %+v", name, MakeSkySnapshot(loaded_sky), MakeSkySnapshot(saved_sky))
+		}
+
+		for i := range saved_sky.boids {
+			if math.Signbit(loaded_sky.boids[i].velocity.x) != math.Signbit(saved_sky.boids[i].velocity.x) ||
+				loaded_sky.boids[i] != saved_sky.boids[i] {
+				t.Errorf("LoadSky(%s) boid %d = %v, want %v", name, i, loaded_sky.boids[i], saved_sky.boids[i])
+			}
+		}
+	}
+}
+
+// TestReadSkyBinaryVersion checks that a binary sky of any other format version is refused
+func TestReadSkyBinaryVersion(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteSkyBinary(&buffer, GenerateRandomSky(5, 100, 100, 1.0, 2.0, 10, 1.5, 1.0, 0.02, 1)); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	if _, err := ReadSkyBinary(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint32{0, 2, 3} {
+		binary.LittleEndian.PutUint32(data[len(skyMagic):], version)
+		if _, err := ReadSkyBinary(bytes.NewReader(data)); err == nil {
+			t.Errorf("ReadSkyBinary accepted version %d", version)
+		}
+	}
+}
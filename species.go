@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Species is a kind of boid with its own flocking parameters and color.
+// The interaction weights say how strongly a boid of this species reacts to each species (in the order of the sky's species):
+// the separation, alignment and cohesion forces from a neighbor are multiplied by the weight of the neighbor's species,
+// so a species that aligns only with itself and keeps away from another has Alignment [1, 0] and Separation [1, 3].
+// An empty list of weights weighs every species 1.
+type Species struct {
+	Name             string    `json:"name"`
+	Proximity        float64   `json:"proximity"`
+	SeparationFactor float64   `json:"separationFactor"`
+	AlignmentFactor  float64   `json:"alignmentFactor"`
+	CohesionFactor   float64   `json:"cohesionFactor"`
+	MaxBoidSpeed     float64   `json:"maxBoidSpeed"`
+	Color            Color     `json:"color"`
+	Separation       []float64 `json:"separation,omitempty"`
+	Alignment        []float64 `json:"alignment,omitempty"`
+	Cohesion         []float64 `json:"cohesion,omitempty"`
+}
+
+// SpeciesParameters is a species of a run file together with the number of boids it starts with
+type SpeciesParameters struct {
+	Species
+	Count int `json:"count"`
+}
+
+// GenerateRandomSpeciesSky extends GenerateRandomSky to several species: counts[k] boids of species[k],
+// numbered one species after the other, placed and headed at random from seed exactly like GenerateRandomSky places as many boids.
+// The sky's proximity and maxBoidSpeed are the largest of the species, so that the spatial grid finds the neighbors of every species.
+func GenerateRandomSpeciesSky(species []Species, counts []int, sky_width, sky_height, initial_speed float64, seed int64) Sky {
+	num_boids := 0
+	proximity, max_speed := 0.0, 0.0
+	for k, s := range species {
+		num_boids += counts[k]
+		proximity = math.Max(proximity, s.Proximity)
+		max_speed = math.Max(max_speed, s.MaxBoidSpeed)
+	}
+
+	initial_sky := GenerateRandomSky(num_boids, sky_width, sky_height, initial_speed, max_speed, proximity, 0, 0, 0, seed)
+	initial_sky.species = species
+
+	i := 0
+	for k := range species {
+		for j := 0; j < counts[k]; j++ {
+			initial_sky.boids[i].species = k
+			i++
+		}
+	}
+
+	return initial_sky
+}
+
+// InteractionFactors returns the separation, alignment and cohesion factors and the proximity that apply to
+// a boid of species s reacting to a neighbor of species other. Without species they are those of the sky.
+func InteractionFactors(current_sky Sky, s, other int) (float64, float64, float64, float64) {
+	if len(current_sky.species) == 0 {
+		return current_sky.separationFactor, current_sky.alignmentFactor, current_sky.cohesionFactor, current_sky.proximity
+	}
+
+	sp := current_sky.species[s]
+	return sp.SeparationFactor * InteractionWeight(sp.Separation, other),
+		sp.AlignmentFactor * InteractionWeight(sp.Alignment, other),
+		sp.CohesionFactor * InteractionWeight(sp.Cohesion, other),
+		sp.Proximity
+}
+
+// InteractionWeight returns the weight of species other in weights, 1 if there are no weights
+func InteractionWeight(weights []float64, other int) float64 {
+	if len(weights) == 0 {
+		return 1
+	}
+	return weights[other]
+}
+
+// SpeciesMaxSpeed returns the speed limit of the boids of species s
+func SpeciesMaxSpeed(current_sky Sky, s int) float64 {
+	if len(current_sky.species) == 0 {
+		return current_sky.maxBoidSpeed
+	}
+	return current_sky.species[s].MaxBoidSpeed
+}
+
+// ValidateSpecies checks the parameters and interaction weights of every species, with one error per problem
+func ValidateSpecies(species []Species) error {
+	var problems []error
+
+	finite := func(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
+
+	for k, s := range species {
+		name := fmt.Sprintf("species %d (%s)", k, s.Name)
+
+		if !finite(s.SeparationFactor) || !finite(s.AlignmentFactor) || !finite(s.CohesionFactor) {
+			problems = append(problems, fmt.Errorf("%s: separationFactor, alignmentFactor and cohesionFactor must be finite", name))
+		}
+		if !(s.Proximity > 0) || !finite(s.Proximity) {
+			problems = append(problems, fmt.Errorf("%s: proximity must be positive and finite, got %v", name, s.Proximity))
+		}
+		if !(s.MaxBoidSpeed >= 0) || !finite(s.MaxBoidSpeed) {
+			problems = append(problems, fmt.Errorf("%s: maxBoidSpeed must be finite and not negative, got %v", name, s.MaxBoidSpeed))
+		}
+
+		for _, weights := range []struct {
+			rule   string
+			values []float64
+		}{{"separation", s.Separation}, {"alignment", s.Alignment}, {"cohesion", s.Cohesion}} {
+			if len(weights.values) != 0 && len(weights.values) != len(species) {
+				problems = append(problems, fmt.Errorf("%s: %s needs one weight per species (%d), got %d", name, weights.rule, len(species), len(weights.values)))
+			}
+			for _, w := range weights.values {
+				if !finite(w) {
+					problems = append(problems, fmt.Errorf("%s: %s weights must be finite, got %v", name, weights.rule, w))
+					break
+				}
+			}
+		}
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestGenerateRandomSpeciesSky checks that the species sky places the boids like GenerateRandomSky and numbers the species in blocks
+func TestGenerateRandomSpeciesSky(t *testing.T) {
+	species := []Species{
+		{Name: "small", Proximity: 50, MaxBoidSpeed: 2},
+		{Name: "large", Proximity: 120, MaxBoidSpeed: 1.5},
+	}
+	sky := GenerateRandomSpeciesSky(species, []int{3, 2}, 500, 400, 1.0, 9)
+	plain := GenerateRandomSky(5, 500, 400, 1.0, 2.0, 120, 0, 0, 0, 9)
+
+	if sky.proximity != 120 || sky.maxBoidSpeed != 2 {
+		t.Errorf("proximity %v and maxBoidSpeed %v, want the largest of the species, 120 and 2", sky.proximity, sky.maxBoidSpeed)
+	}
+	for i, b := range sky.boids {
+		want_species := 0
+		if i >= 3 {
+			want_species = 1
+		}
+		if b.species != want_species || b.id != i || b.position != plain.boids[i].position || b.velocity != plain.boids[i].velocity {
+			t.Errorf("boid %d = %+v, want species %d at %v", i, b, want_species, plain.boids[i].position)
+		}
+	}
+}
+
+// TestComputeNetForceSpecies checks the interaction weights: species 0 aligns only with itself and keeps three times as far from species 1,
+// and a single species with the sky's own parameters gives exactly the forces of a sky without species
+func TestComputeNetForceSpecies(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+		{id: 1, position: OrderedPair{x: 53, y: 54}, velocity: OrderedPair{x: 0, y: 1}},
+	}
+	want := ComputeNetForce(sky, sky.boids[0])
+
+	same := CopySky(sky)
+	same.species = []Species{{Proximity: 10, SeparationFactor: 1.5, AlignmentFactor: 1.0, CohesionFactor: 0.2}}
+	if result := ComputeNetForce(same, same.boids[0]); result != want {
+		t.Errorf("ComputeNetForce with one species = %v, want %v", result, want)
+	}
+
+	mixed := CopySky(sky)
+	mixed.species = []Species{
+		{Proximity: 10, SeparationFactor: 1.5, AlignmentFactor: 1.0, CohesionFactor: 0.2, Separation: []float64{1, 3}, Alignment: []float64{1, 0}},
+		{Proximity: 10, SeparationFactor: 1.5, AlignmentFactor: 1.0, CohesionFactor: 0.2},
+	}
+	mixed.boids[1].species = 1
+
+	// distance 5: separation 1.5*3*(-3, -4)/25, no alignment, cohesion 0.2*(3, 4)/5
+	result := ComputeNetForce(mixed, mixed.boids[0])
+	want_mixed := OrderedPair{x: 4.5*-3/25 + 0.2*3/5, y: 4.5*-4/25 + 0.2*4/5}
+	if math.Abs(result.x-want_mixed.x) > 1e-12 || math.Abs(result.y-want_mixed.y) > 1e-12 {
+		t.Errorf("ComputeNetForce across species = %v, want %v", result, want_mixed)
+	}
+
+	// the other species reacts with its default weights
+	if result := ComputeNetForce(mixed, mixed.boids[1]); result != ComputeNetForce(sky, sky.boids[1]) {
+		t.Errorf("ComputeNetForce of species 1 = %v, want %v", result, ComputeNetForce(sky, sky.boids[1]))
+	}
+}
+
+// TestSpeciesRunFile reads species from a run file, generates their sky, keeps each species under its own speed limit,
+// and rejects weights that do not match the number of species
+func TestSpeciesRunFile(t *testing.T) {
+	run_file := filepath.Join(t.TempDir(), "run.json")
+	content := `{"skyWidth": 600, "species": [
+		{"name": "sparrows", "count": 30, "proximity": 80, "separationFactor": 1.5, "alignmentFactor": 1, "cohesionFactor": 0.02,
+		 "maxBoidSpeed": 2, "color": {"R": 200, "G": 50, "B": 50, "A": 255}, "alignment": [1, 0]},
+		{"name": "starlings", "count": 20, "proximity": 120, "separationFactor": 1, "alignmentFactor": 1.5, "cohesionFactor": 0.05,
+		 "maxBoidSpeed": 1.2, "color": {"R": 20, "G": 20, "B": 20, "A": 255}, "separation": [2, 1]}]}`
+	if err := os.WriteFile(run_file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := ParseParameters([]string{"-config", run_file, "-numGens", "50"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sky, err := InitialSky(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sky.boids) != 50 || len(sky.species) != 2 || sky.species[1].Name != "starlings" || sky.proximity != 120 {
+		t.Fatalf("InitialSky made %d boids of %d species with proximity %v", len(sky.boids), len(sky.species), sky.proximity)
+	}
+
+	time_points, err := SimulateBoids(sky, params.NumGens, params.TimeStep, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range time_points[len(time_points)-1].boids {
+		limit := sky.species[b.species].MaxBoidSpeed
+		if speed := math.Sqrt(b.velocity.x*b.velocity.x + b.velocity.y*b.velocity.y); speed > limit+1e-12 {
+			t.Errorf("boid %d of species %d flies at %v, faster than %v", b.id, b.species, speed, limit)
+		}
+	}
+
+	// species survive a snapshot
+	snapshot_file := filepath.Join(t.TempDir(), "sky.sky")
+	if err := SaveSky(snapshot_file, time_points[1]); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSky(snapshot_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(MakeSkySnapshot(loaded), MakeSkySnapshot(time_points[1])) {
+		t.Errorf("LoadSky lost the species: %+v", MakeSkySnapshot(loaded).Species)
+	}
+
+	params.Species[0].Cohesion = []float64{1, 1, 1}
+	if err := ValidateParameters(params); err == nil {
+		t.Errorf("ValidateParameters accepted 3 cohesion weights for 2 species")
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SweepAxis is one parameter varied by a sweep: the flag name of the parameter and the values it takes
+type SweepAxis struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// SweepRun is one simulation of a sweep: a value for every axis, and a replicate number that selects the seed
+type SweepRun struct {
+	Values    []string // Values[k] is the value of axis k
+	Replicate int
+	Seed      int64
+	Params    Parameters
+}
+
+// SweepResult holds the flock metrics of one run, averaged over the last generations of the run (in the order of MetricNames)
+type SweepResult struct {
+	Metrics []float64
+	Err     error
+}
+
+// Sweep runs "boids sweep": the parameters given by the usual flags form the base of every run,
+// and each -vary flag lists the values of one parameter, so that every combination of values is simulated
+// -replicates times. The summary table, and optionally a phase diagram, are written to -sweepDir.
+func Sweep(args []string) error {
+	params := DefaultParameters()
+	fs := NewParameterFlagSet(&params)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: boids sweep -vary name=from:to:n|v1,v2,... [-vary ...] [sweep flags] [flags]")
+		fs.PrintDefaults()
+	}
+
+	var axes []SweepAxis
+	fs.Func("vary", "sweep: parameter to vary, as name=from:to:n (n evenly spaced values) or name=v1,v2,... (repeatable)", func(s string) error {
+		axis, err := ParseSweepAxis(s)
+		if err != nil {
+			return err
+		}
+		// the arguments are parsed twice when a run file is given; keep each axis once
+		for k := range axes {
+			if axes[k].Name == axis.Name {
+				axes[k] = axis
+				return nil
+			}
+		}
+		axes = append(axes, axis)
+		return nil
+	})
+	replicates := fs.Int("replicates", 1, "sweep: number of runs of each combination, with seeds seed, seed+1, ...")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "sweep: number of simulations run at the same time")
+	tail := fs.Float64("tail", 0.25, "sweep: fraction of the last generations over which the metrics are averaged")
+	sweep_dir := fs.String("sweepDir", "output/sweep", "sweep: directory of the summary table and phase diagram")
+	phase := fs.String("phase", "", "sweep: two varied parameters x,y to draw a phase diagram of (empty draws none)")
+	phase_metric := fs.String("phaseMetric", "polarization", "sweep: metric shown by the phase diagram, one of "+strings.Join(MetricNames, ", "))
+
+	if err := ParseParameterFlags(fs, &params, args); err != nil {
+		return err
+	}
+
+	if len(axes) == 0 {
+		return fmt.Errorf("%w: sweep: no parameter to vary (use -vary name=values)", ErrInvalidParameters)
+	}
+	if *replicates <= 0 || *workers <= 0 {
+		return fmt.Errorf("%w: sweep: nonpositive replicates %d or workers %d", ErrInvalidParameters, *replicates, *workers)
+	}
+	if *tail <= 0 || *tail > 1 {
+		return fmt.Errorf("%w: sweep: tail %v must be in (0, 1]", ErrInvalidParameters, *tail)
+	}
+
+	// fixed seeds: replicate r of every combination uses the same seed
+	if params.Seed == 0 {
+		params.Seed = 1
+	}
+
+	runs, err := SweepRuns(params, axes, *replicates)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*sweep_dir, 0o755); err != nil {
+		return err
+	}
+	if err := SaveParameters(filepath.Join(*sweep_dir, "params.json"), params); err != nil {
+		return err
+	}
+
+	// the manifest lists every run with its parameters; it is saved before the runs, so that an interrupted sweep still shows up
+	manifest_file := filepath.Join(*sweep_dir, "manifest.json")
+	manifest := NewSweepManifest(params, args, axes, runs)
+	if err := SaveManifest(manifest_file, manifest); err != nil {
+		return err
+	}
+
+	fmt.Println("Sweeping", len(runs), "runs on", *workers, "workers")
+	results := RunSweep(runs, *workers, *tail)
+
+	manifest.EndSweep(results)
+	if err := SaveManifest(manifest_file, manifest); err != nil {
+		return err
+	}
+	fmt.Println("Sweep described in", manifest_file)
+
+	summary_file := filepath.Join(*sweep_dir, "summary.csv")
+	if err := WriteSweepSummary(summary_file, axes, runs, results); err != nil {
+		return err
+	}
+	fmt.Println("Summary written to", summary_file)
+
+	if *phase != "" {
+		x_axis, y_axis, ok := strings.Cut(*phase, ",")
+		if !ok {
+			return fmt.Errorf("%w: sweep: phase %q must name two parameters as x,y", ErrInvalidParameters, *phase)
+		}
+		phase_file := filepath.Join(*sweep_dir, "phase_"+*phase_metric+".png")
+		if err := DrawPhaseDiagram(phase_file, axes, runs, results, x_axis, y_axis, *phase_metric); err != nil {
+			return err
+		}
+		fmt.Println("Phase diagram drawn in", phase_file)
+	}
+
+	for k, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("sweep run %d: %w", k, result.Err)
+		}
+	}
+
+	return nil
+}
+
+// sweepListFlags are the flags whose values are themselves comma-separated lists, which a list of axis values cannot hold
+var sweepListFlags = []string{"rules", "track", "trajectory", "obstacleColor", "predatorColor", "trackColor", "boidColor", "backgroundColor"}
+
+// ParseSweepAxis parses a -vary value: name=from:to:n for n evenly spaced values from from to to, or name=v1,v2,...
+func ParseSweepAxis(s string) (SweepAxis, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok || name == "" || spec == "" {
+		return SweepAxis{}, fmt.Errorf("sweep axis %q must be name=from:to:n or name=v1,v2,...", s)
+	}
+
+	// the seed of each run is seed+replicate, so an axis could not set it
+	if name == "seed" {
+		return SweepAxis{}, fmt.Errorf("sweep axis %q: seed cannot be varied; use -seed and -replicates for runs with different seeds", s)
+	}
+
+	if slices.Contains(sweepListFlags, name) {
+		return SweepAxis{}, fmt.Errorf("sweep axis %q: %s takes a comma-separated value and cannot be varied; set it with its own flag", s, name)
+	}
+
+	axis := SweepAxis{Name: name}
+
+	if bounds := strings.Split(spec, ":"); len(bounds) == 3 {
+		from, err1 := strconv.ParseFloat(bounds[0], 64)
+		to, err2 := strconv.ParseFloat(bounds[1], 64)
+		n, err3 := strconv.Atoi(bounds[2])
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return SweepAxis{}, fmt.Errorf("sweep axis %q: %w", s, err)
+		}
+		if n <= 0 {
+			return SweepAxis{}, fmt.Errorf("sweep axis %q: nonpositive number of values", s)
+		}
+
+		for i := 0; i < n; i++ {
+			value := from
+			if n > 1 {
+				value = from + (to-from)*float64(i)/float64(n-1)
+			}
+			axis.Values = append(axis.Values, FormatFloat(value))
+		}
+		return axis, nil
+	}
+
+	for _, value := range strings.Split(spec, ",") {
+		axis.Values = append(axis.Values, strings.TrimSpace(value))
+	}
+
+	return axis, nil
+}
+
+// SweepRuns lists every combination of the axes' values, each repeated replicates times, with the first axis varying slowest.
+// Each value is applied to a copy of params through the parameter's own flag, so any flag can be an axis.
+func SweepRuns(params Parameters, axes []SweepAxis, replicates int) ([]SweepRun, error) {
+	runs := []SweepRun{{}}
+
+	for _, axis := range axes {
+		var expanded []SweepRun
+		for _, run := range runs {
+			for _, value := range axis.Values {
+				expanded = append(expanded, SweepRun{Values: append(append([]string(nil), run.Values...), value)})
+			}
+		}
+		runs = expanded
+	}
+
+	var replicated []SweepRun
+	for _, run := range runs {
+		for r := 0; r < replicates; r++ {
+			run_params := params
+			fs := NewParameterFlagSet(&run_params)
+			for k, axis := range axes {
+				if fs.Lookup(axis.Name) == nil {
+					return nil, fmt.Errorf("%w: sweep: unknown parameter %q", ErrInvalidParameters, axis.Name)
+				}
+				if err := fs.Set(axis.Name, run.Values[k]); err != nil {
+					return nil, fmt.Errorf("%w: sweep: %s=%s: %w", ErrInvalidParameters, axis.Name, run.Values[k], err)
+				}
+			}
+			run_params.Seed = params.Seed + int64(r)
+
+			// check every combination before the first simulation starts
+			if err := ValidateParameters(run_params); err != nil {
+				return nil, fmt.Errorf("sweep values %s: %w", strings.Join(run.Values, ", "), err)
+			}
+
+			replicated = append(replicated, SweepRun{Values: run.Values, Replicate: r, Seed: run_params.Seed, Params: run_params})
+		}
+	}
+
+	return replicated, nil
+}
+
+// RunSweep simulates the runs on num_workers goroutines. Every run only depends on its own parameters and seed,
+// so the results are the same for any number of workers.
+func RunSweep(runs []SweepRun, num_workers int, tail float64) []SweepResult {
+	results := make([]SweepResult, len(runs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < num_workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				results[k].Metrics, results[k].Err = SimulateMetrics(runs[k].Params, tail)
+			}
+		}()
+	}
+
+	for k := range runs {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// SimulateMetrics simulates params without drawing anything and returns the flock metrics (in the order of MetricNames)
+// averaged over the last fraction tail of the generations
+func SimulateMetrics(params Parameters, tail float64) ([]float64, error) {
+	initial_sky, err := InitialSky(params)
+	if err != nil {
+		return nil, err
+	}
+
+	first_gen := params.NumGens - int(math.Ceil(tail*float64(params.NumGens)))
+	sums := make([]float64, len(MetricNames))
+	count := 0
+
+	err = StreamBoids(initial_sky, params.NumGens, params.TimeStep, false, func(gen int, sky Sky) error {
+		if gen < first_gen {
+			return nil
+		}
+		for k, value := range MetricValues(ComputeFlockMetrics(sky)) {
+			sums[k] += value
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range sums {
+		sums[k] /= float64(count)
+	}
+
+	return sums, nil
+}
+
+// WriteSweepSummary writes one CSV row per run: the run number, the value of every axis, the replicate, the seed,
+// and the averaged metrics (empty if the run failed)
+func WriteSweepSummary(filename string, axes []SweepAxis, runs []SweepRun, results []SweepResult) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	header := []string{"run"}
+	for _, axis := range axes {
+		header = append(header, axis.Name)
+	}
+	header = append(header, "replicate", "seed")
+	header = append(header, MetricNames...)
+	w.WriteString(strings.Join(header, ",") + "\n")
+
+	for k, run := range runs {
+		row := []string{strconv.Itoa(k)}
+		row = append(row, run.Values...)
+		row = append(row, strconv.Itoa(run.Replicate), strconv.FormatInt(run.Seed, 10))
+		for i := range MetricNames {
+			value := ""
+			if results[k].Err == nil {
+				value = FormatFloat(results[k].Metrics[i])
+			}
+			row = append(row, value)
+		}
+		w.WriteString(strings.Join(row, ",") + "\n")
+	}
+
+	err = w.Flush()
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+
+	return err
+}
+
+// phaseCellSize is the width and height in pixels of one cell of a phase diagram
+const phaseCellSize = 40
+
+// DrawPhaseDiagram draws a PNG with one cell per pair of values of the axes named x_name and y_name
+// (x to the right, y upwards), colored from dark blue (lowest) to yellow (highest) by the metric,
+// averaged over the replicates and over any other axis
+func DrawPhaseDiagram(filename string, axes []SweepAxis, runs []SweepRun, results []SweepResult, x_name, y_name, metric string) error {
+	x_axis, y_axis, metric_index := -1, -1, -1
+	for k, axis := range axes {
+		if axis.Name == x_name {
+			x_axis = k
+		}
+		if axis.Name == y_name {
+			y_axis = k
+		}
+	}
+	for i, name := range MetricNames {
+		if name == metric {
+			metric_index = i
+		}
+	}
+	if x_axis < 0 || y_axis < 0 || x_axis == y_axis {
+		return fmt.Errorf("phase diagram: %q and %q must be two different varied parameters", x_name, y_name)
+	}
+	if metric_index < 0 {
+		return fmt.Errorf("phase diagram: unknown metric %q", metric)
+	}
+
+	cols, rows := len(axes[x_axis].Values), len(axes[y_axis].Values)
+	sums := make([]float64, cols*rows)
+	counts := make([]int, cols*rows)
+
+	index_of := func(axis int, value string) int {
+		for i, v := range axes[axis].Values {
+			if v == value {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for k, run := range runs {
+		if results[k].Err != nil {
+			continue
+		}
+		cell := index_of(y_axis, run.Values[y_axis])*cols + index_of(x_axis, run.Values[x_axis])
+		sums[cell] += results[k].Metrics[metric_index]
+		counts[cell]++
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for cell := range sums {
+		if counts[cell] > 0 {
+			sums[cell] /= float64(counts[cell])
+			low, high = math.Min(low, sums[cell]), math.Max(high, sums[cell])
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cols*phaseCellSize, rows*phaseCellSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src) // cells without results stay gray
+
+	for cell := range sums {
+		if counts[cell] == 0 {
+			continue
+		}
+
+		t := 0.5
+		if high > low {
+			t = (sums[cell] - low) / (high - low)
+		}
+
+		col, row := cell%cols, cell/cols
+		rect := image.Rect(col*phaseCellSize, (rows-1-row)*phaseCellSize, (col+1)*phaseCellSize, (rows-row)*phaseCellSize)
+		draw.Draw(img, rect, image.NewUniform(PhaseColor(t)), image.Point{}, draw.Src)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(f, img)
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+
+	return err
+}
+
+// PhaseColor maps t in [0, 1] onto a dark blue to yellow color scale
+func PhaseColor(t float64) color.RGBA {
+	t = math.Max(0, math.Min(t, 1))
+	return color.RGBA{R: uint8(40 + 215*t), G: uint8(20 + 210*t), B: uint8(120 - 100*t), A: 255}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseSweepAxis checks ranges and lists of values
+func TestParseSweepAxis(t *testing.T) {
+	tests := []struct {
+		spec string
+		want SweepAxis
+	}{
+		{"separationFactor=0:2:5", SweepAxis{"separationFactor", []string{"0", "0.5", "1", "1.5", "2"}}},
+		{"proximity=50:50:1", SweepAxis{"proximity", []string{"50"}}},
+		{"boundary=wrap, reflect", SweepAxis{"boundary", []string{"wrap", "reflect"}}},
+	}
+
+	for _, test := range tests {
+		axis, err := ParseSweepAxis(test.spec)
+		if err != nil || !reflect.DeepEqual(axis, test.want) {
+			t.Errorf("ParseSweepAxis(%q) = %v, %v, want %v", test.spec, axis, err, test.want)
+		}
+	}
+
+	for _, spec := range []string{"separationFactor", "=1,2", "cohesionFactor=0:1:0", "cohesionFactor=0:x:3", "seed=1,2,3", "boidColor=255,0,0", "rules=separation,cohesion"} {
+		if _, err := ParseSweepAxis(spec); err == nil {
+			t.Errorf("ParseSweepAxis(%q) accepted a bad axis", spec)
+		}
+	}
+}
+
+// TestSweepRuns checks that every combination is run with its values and with the same seeds for each combination
+func TestSweepRuns(t *testing.T) {
+	params := DefaultParameters()
+	params.Seed = 10
+	axes := []SweepAxis{{"alignmentFactor", []string{"0", "1"}}, {"numBoids", []string{"5", "6", "7"}}}
+
+	runs, err := SweepRuns(params, axes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 12 {
+		t.Fatalf("SweepRuns made %d runs, want 12", len(runs))
+	}
+
+	last := runs[11]
+	if last.Params.AlignmentFactor != 1 || last.Params.NumBoids != 7 || last.Seed != 11 || last.Params.Seed != 11 {
+		t.Errorf("last run %+v", last)
+	}
+	if runs[0].Seed != 10 || runs[2].Seed != 10 || runs[2].Params.NumBoids != 6 {
+		t.Errorf("runs 0 and 2: %+v, %+v", runs[0], runs[2])
+	}
+
+	for _, bad := range []SweepAxis{{"noSuchParameter", []string{"1"}}, {"numBoids", []string{"1.5"}}} {
+		if _, err := SweepRuns(params, []SweepAxis{bad}, 1); err == nil {
+			t.Errorf("SweepRuns accepted %v", bad)
+		}
+	}
+}
+
+// TestSweep runs a small sweep and checks that the results do not depend on the number of workers
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"-numBoids", "20", "-skyWidth", "400", "-proximity", "80", "-numGens", "20", "-seed", "3",
+		"-vary", "cohesionFactor=0:0.1:2", "-vary", "separationFactor=0.5,1.5", "-replicates", "2",
+		"-phase", "separationFactor,cohesionFactor"}
+
+	var summaries []string
+	for _, workers := range []string{"1", "3"} {
+		sweep_dir := filepath.Join(dir, workers)
+		if err := Sweep(append(args, "-workers", workers, "-sweepDir", sweep_dir)); err != nil {
+			t.Fatal(err)
+		}
+
+		summary, err := os.ReadFile(filepath.Join(sweep_dir, "summary.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		summaries = append(summaries, string(summary))
+
+		if info, err := os.Stat(filepath.Join(sweep_dir, "phase_polarization.png")); err != nil || info.Size() == 0 {
+			t.Errorf("no phase diagram: %v", err)
+		}
+
+		// the manifest records the parameters of every run, enough to run it again on its own
+		var manifest SweepManifest
+		data, err := os.ReadFile(filepath.Join(sweep_dir, "manifest.json"))
+		if err == nil {
+			err = json.Unmarshal(data, &manifest)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Runs) != 8 || len(manifest.Axes) != 2 || len(manifest.Sessions) != 1 || manifest.Sessions[0].End == nil {
+			t.Fatalf("manifest has %d runs, %d axes and sessions %+v, want 8 runs, 2 axes and one finished session",
+				len(manifest.Runs), len(manifest.Axes), manifest.Sessions)
+		}
+		last := manifest.Runs[7]
+		if last.Parameters.CohesionFactor != 0.1 || last.Parameters.SeparationFactor != 1.5 || last.Seed != 4 || last.Parameters.Seed != 4 {
+			t.Errorf("last run of the manifest %+v", last)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(summaries[0]), "\n")
+	if len(lines) != 9 || !strings.HasPrefix(lines[0], "run,cohesionFactor,separationFactor,replicate,seed,polarization") {
+		t.Errorf("summary has %d lines, header %q", len(lines), lines[0])
+	}
+	if summaries[0] != summaries[1] {
+		t.Errorf("summaries differ between 1 and 3 workers:\n%s\n%s", summaries[0], summaries[1])
+	}
+}
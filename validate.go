@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidParameters is wrapped by every error about parameters that cannot be simulated,
+// so that main can tell a bad command line from a failure during the run
+var ErrInvalidParameters = errors.New("invalid parameters")
+
+// ErrNotFinite is wrapped by every error about a boid or predator whose state stopped being a finite number,
+// which is how a simulation whose forces blew up ends
+var ErrNotFinite = errors.New("not finite")
+
+// UsageError marks an error from parsing the command line as invalid parameters; -help is left as flag.ErrHelp
+func UsageError(err error) error {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidParameters, err)
+}
+
+// ExitCode returns the exit status of the program after err: 0 on success or -help,
+// 2 when the parameters are invalid, and 1 when the run itself failed
+func ExitCode(err error) int {
+	switch {
+	case err == nil || errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, ErrInvalidParameters):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ValidateParameters checks every parameter of a run before anything is simulated or written,
+// and reports all the problems at once, one per line
+func ValidateParameters(params Parameters) error {
+	var problems []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	finite := []struct {
+		name  string
+		value float64
+	}{
+		{"skyWidth", params.SkyWidth}, {"skyHeight", params.SkyHeight}, {"initialSpeed", params.InitialSpeed},
+		{"maxBoidSpeed", params.MaxBoidSpeed}, {"proximity", params.Proximity}, {"separationFactor", params.SeparationFactor},
+		{"alignmentFactor", params.AlignmentFactor}, {"cohesionFactor", params.CohesionFactor}, {"timeStep", params.TimeStep},
+		{"boidSize", params.BoidSize}, {"wallMargin", params.WallMargin}, {"wallFactor", params.WallFactor},
+		{"avoidanceFactor", params.AvoidanceFactor}, {"avoidanceDistance", params.AvoidanceDistance},
+		{"maxPredatorSpeed", params.MaxPredatorSpeed}, {"pursuitFactor", params.PursuitFactor}, {"fearRadius", params.FearRadius},
+		{"fleeFactor", params.FleeFactor}, {"catchRadius", params.CatchRadius}, {"maxForce", params.MaxForce}, {"noise", params.Noise},
+	}
+	for _, field := range finite {
+		check(!math.IsNaN(field.value) && !math.IsInf(field.value, 0), "%s must be a finite number, got %v", field.name, field.value)
+	}
+
+	check(params.NumBoids >= 0, "numBoids must not be negative, got %d", params.NumBoids)
+	check(params.SkyWidth > 0, "skyWidth must be positive, got %v", params.SkyWidth)
+	check(params.SkyHeight >= 0, "skyHeight must be positive, or 0 for a square sky, got %v", params.SkyHeight)
+	check(params.InitialSpeed >= 0, "initialSpeed must not be negative, got %v", params.InitialSpeed)
+	check(params.MaxBoidSpeed >= params.InitialSpeed, "maxBoidSpeed (%v) must be at least initialSpeed (%v)", params.MaxBoidSpeed, params.InitialSpeed)
+	check(params.NumGens >= 0, "numGens must not be negative, got %d", params.NumGens)
+	check(params.Proximity > 0, "proximity must be positive, got %v", params.Proximity)
+	check(params.TimeStep > 0, "timeStep must be positive, got %v", params.TimeStep)
+	check(params.CanvasWidth > 0, "canvasWidth must be positive, got %d", params.CanvasWidth)
+	check(params.CanvasHeight >= 0, "canvasHeight must be positive, or 0 to follow the sky, got %d", params.CanvasHeight)
+	check(params.CanvasWidth <= gifMaxSize, "canvasWidth must be at most %d, got %d", gifMaxSize, params.CanvasWidth)
+	check(CanvasHeightOf(params) <= gifMaxSize, "canvas height must be at most %d, got %.0f", gifMaxSize, CanvasHeightOf(params))
+	check(params.ImageFrequency > 0, "imageFrequency must be positive, got %d", params.ImageFrequency)
+	check(params.BoidSize > 0, "boidSize must be positive, got %v", params.BoidSize)
+	check(params.WallMargin >= 0, "wallMargin must not be negative, got %v", params.WallMargin)
+	check(params.AvoidanceDistance >= 0, "avoidanceDistance must not be negative, got %v", params.AvoidanceDistance)
+	check(params.NumPredators >= 0, "numPredators must not be negative, got %d", params.NumPredators)
+	check(params.MaxPredatorSpeed >= 0, "maxPredatorSpeed must not be negative, got %v", params.MaxPredatorSpeed)
+	check(params.FearRadius >= 0, "fearRadius must not be negative, got %v", params.FearRadius)
+	check(params.CatchRadius >= 0, "catchRadius must not be negative, got %v", params.CatchRadius)
+	check(params.MaxForce >= 0, "maxForce must not be negative, got %v", params.MaxForce)
+	check(params.Noise >= 0 && params.Noise <= 2*math.Pi, "noise must be from 0 to 2π radians, got %v", params.Noise)
+	check(params.NeighborMode == MetricNeighbors || params.NumNeighbors > 0, "numNeighbors must be positive in the topological neighbor mode, got %d", params.NumNeighbors)
+	check(params.SnapshotFrequency >= 0, "snapshotFrequency must not be negative, got %d", params.SnapshotFrequency)
+	check(params.SnapshotFormat == "json" || params.SnapshotFormat == "binary", "snapshotFormat must be json or binary, got %q", params.SnapshotFormat)
+	check(params.CheckpointFrequency >= 0, "checkpointFrequency must not be negative, got %d", params.CheckpointFrequency)
+	check(params.MetricsFrequency >= 0, "metricsFrequency must not be negative, got %d", params.MetricsFrequency)
+	check(params.FlocksFrequency >= 0, "flocksFrequency must not be negative, got %d", params.FlocksFrequency)
+	check(params.Output != "", "output must not be empty")
+
+	if err := ValidateVision(MakeVision(params)); err != nil {
+		problems = append(problems, err)
+	}
+	if err := ValidateRules(params.Rules); err != nil {
+		problems = append(problems, err)
+	}
+
+	species := make([]Species, len(params.Species))
+	for k, s := range params.Species {
+		species[k] = s.Species
+		check(s.Count >= 0, "species %d (%s): count must not be negative, got %d", k, s.Name, s.Count)
+		check(s.MaxBoidSpeed >= params.InitialSpeed, "species %d (%s): maxBoidSpeed (%v) must be at least initialSpeed (%v)", k, s.Name, s.MaxBoidSpeed, params.InitialSpeed)
+	}
+	if err := ValidateSpecies(species); err != nil {
+		problems = append(problems, err)
+	}
+
+	formats, err := ParseTrajectoryFormats(params.Trajectory)
+	check(err == nil, "%v", err)
+	check(len(formats) == 0 || params.TrajectoryFrequency > 0, "trajectoryFrequency must be positive, got %d", params.TrajectoryFrequency)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n%w", ErrInvalidParameters, errors.Join(problems...))
+	}
+
+	return nil
+}
+
+// CanvasHeightOf returns the height in pixels of the images drawn with params,
+// following the aspect ratio of the sky (square without skyHeight) when canvasHeight is 0, as CanvasSize does
+func CanvasHeightOf(params Parameters) float64 {
+	if params.CanvasHeight > 0 || !(params.SkyWidth > 0) {
+		return float64(params.CanvasHeight)
+	}
+	sky_height := params.SkyHeight
+	if sky_height == 0 {
+		sky_height = params.SkyWidth
+	}
+	return math.Round(float64(params.CanvasWidth) * sky_height / params.SkyWidth)
+}
+
+// ValidateSky checks that current_sky can be simulated: a sky of positive size, a positive proximity,
+// well-formed species, rules, obstacles and predator parameters, and boids and predators with finite positions and velocities
+func ValidateSky(current_sky Sky) error {
+	var problems []error
+
+	if !(current_sky.width > 0) || !(current_sky.height > 0) || math.IsInf(current_sky.width, 0) || math.IsInf(current_sky.height, 0) {
+		problems = append(problems, fmt.Errorf("sky size must be positive and finite, got %v x %v", current_sky.width, current_sky.height))
+	}
+	if !(current_sky.proximity > 0) || math.IsInf(current_sky.proximity, 0) {
+		problems = append(problems, fmt.Errorf("proximity must be positive and finite, got %v", current_sky.proximity))
+	}
+	if !(current_sky.maxBoidSpeed >= 0) || math.IsInf(current_sky.maxBoidSpeed, 0) {
+		problems = append(problems, fmt.Errorf("maxBoidSpeed must be finite and not negative, got %v", current_sky.maxBoidSpeed))
+	}
+	if !(current_sky.avoidanceDistance >= 0) || math.IsInf(current_sky.avoidanceDistance, 0) {
+		problems = append(problems, fmt.Errorf("avoidanceDistance must be finite and not negative, got %v", current_sky.avoidanceDistance))
+	}
+	if math.IsNaN(current_sky.avoidanceFactor) || math.IsInf(current_sky.avoidanceFactor, 0) {
+		problems = append(problems, fmt.Errorf("avoidanceFactor must be finite, got %v", current_sky.avoidanceFactor))
+	}
+	for _, field := range []struct {
+		name  string
+		value float64
+	}{{"maxPredatorSpeed", current_sky.maxPredatorSpeed}, {"fearRadius", current_sky.fearRadius}, {"catchRadius", current_sky.catchRadius}, {"maxForce", current_sky.maxForce}} {
+		if !(field.value >= 0) || math.IsInf(field.value, 0) {
+			problems = append(problems, fmt.Errorf("%s must be finite and not negative, got %v", field.name, field.value))
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value float64
+	}{{"pursuitFactor", current_sky.pursuitFactor}, {"fleeFactor", current_sky.fleeFactor}} {
+		if math.IsNaN(field.value) || math.IsInf(field.value, 0) {
+			problems = append(problems, fmt.Errorf("%s must be finite, got %v", field.name, field.value))
+		}
+	}
+	if !(current_sky.noise >= 0 && current_sky.noise <= 2*math.Pi) {
+		problems = append(problems, fmt.Errorf("noise must be from 0 to 2π radians, got %v", current_sky.noise))
+	}
+	if current_sky.model == VicsekModel && current_sky.noise > 0 && current_sky.rng == nil {
+		problems = append(problems, errors.New("the noise of the Vicsek model needs the random generator of the sky"))
+	}
+	if current_sky.neighborMode == TopologicalNeighbors && current_sky.numNeighbors <= 0 {
+		problems = append(problems, fmt.Errorf("numNeighbors must be positive in the topological neighbor mode, got %d", current_sky.numNeighbors))
+	}
+	if err := ValidateVision(current_sky.vision); err != nil {
+		problems = append(problems, err)
+	}
+	if err := ValidateRules(current_sky.rules); err != nil {
+		problems = append(problems, err)
+	}
+	if err := ValidateSpecies(current_sky.species); err != nil {
+		problems = append(problems, err)
+	}
+	for k, s := range current_sky.species {
+		if s.Proximity > current_sky.proximity {
+			problems = append(problems, fmt.Errorf("species %d (%s): proximity %v is larger than the proximity of the sky (%v)", k, s.Name, s.Proximity, current_sky.proximity))
+		}
+	}
+	for _, b := range current_sky.boids {
+		if b.species < 0 || b.species >= max(len(current_sky.species), 1) {
+			problems = append(problems, fmt.Errorf("boid %d is of species %d, but the sky has %d species", b.id, b.species, max(len(current_sky.species), 1)))
+			break
+		}
+	}
+	for k, o := range current_sky.obstacles {
+		if err := ValidateObstacle(o); err != nil {
+			problems = append(problems, fmt.Errorf("obstacle %d: %w", k, err))
+		}
+	}
+	if err := CheckFiniteSky(current_sky); err != nil {
+		problems = append(problems, err)
+	} else if err := CheckInsideSky(current_sky); err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n%w", ErrInvalidParameters, errors.Join(problems...))
+	}
+
+	return nil
+}
+
+// CheckFiniteSky returns an error naming the first boid (or predator) of current_sky whose position, velocity or acceleration
+// is not a finite number, so that a simulation that blows up stops instead of drawing NaNs
+func CheckFiniteSky(current_sky Sky) error {
+	for _, kind := range []struct {
+		name   string
+		agents []Boid
+	}{{"boid", current_sky.boids}, {"predator", current_sky.predators}} {
+		for _, b := range kind.agents {
+			if err := CheckFiniteBoid(kind.name, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckFiniteBoid returns an error wrapping ErrNotFinite if the position, velocity or acceleration of b
+// (a boid or a predator, as kind says) is not a finite number
+func CheckFiniteBoid(kind string, b Boid) error {
+	for _, v := range []float64{b.position.x, b.position.y, b.velocity.x, b.velocity.y, b.acceleration.x, b.acceleration.y} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%s %d is %w: position %v, velocity %v, acceleration %v", kind, b.id, ErrNotFinite, b.position, b.velocity, b.acceleration)
+		}
+	}
+
+	return nil
+}
+
+// CheckInsideSky returns an error naming the first boid (or predator) of current_sky outside [0, width] x [0, height]
+// when the edges of the sky keep every boid inside it (wrapping and reflecting edges).
+// Soft walls only push boids back, and an open sky has no edges, so there boids may be anywhere.
+func CheckInsideSky(current_sky Sky) error {
+	if current_sky.boundary != WrapBoundary && current_sky.boundary != ReflectBoundary {
+		return nil
+	}
+
+	for _, kind := range []struct {
+		name   string
+		agents []Boid
+	}{{"boid", current_sky.boids}, {"predator", current_sky.predators}} {
+		for _, b := range kind.agents {
+			if b.position.x < 0 || b.position.x > current_sky.width || b.position.y < 0 || b.position.y > current_sky.height {
+				return fmt.Errorf("%s %d at %v is outside the %v x %v sky", kind.name, b.id, b.position, current_sky.width, current_sky.height)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestValidateParameters checks that every invalid parameter is reported, all in one error
+func TestValidateParameters(t *testing.T) {
+	if err := ValidateParameters(DefaultParameters()); err != nil {
+		t.Fatalf("default parameters rejected: %v", err)
+	}
+
+	params := DefaultParameters()
+	params.NumBoids = -1
+	params.SkyWidth = 0
+	params.Proximity = -5
+	params.TimeStep = math.NaN()
+	params.InitialSpeed, params.MaxBoidSpeed = 3, 2
+	params.CanvasWidth = 0
+	params.SnapshotFormat = "xml"
+
+	err := ValidateParameters(params)
+	if !errors.Is(err, ErrInvalidParameters) || ExitCode(err) != 2 {
+		t.Fatalf("ValidateParameters = %v, want ErrInvalidParameters", err)
+	}
+	for _, name := range []string{"numBoids", "skyWidth", "proximity", "timeStep", "maxBoidSpeed", "canvasWidth", "snapshotFormat"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %s:\n%v", name, err)
+		}
+	}
+
+	// the GIF header holds sizes up to 65535 pixels, including a height that follows a tall sky
+	for _, args := range [][]string{{"-canvasWidth", "70000"}, {"-canvasWidth", "2000", "-skyWidth", "100", "-skyHeight", "5000"}} {
+		if _, err := ParseParameters(args); !errors.Is(err, ErrInvalidParameters) || !strings.Contains(err.Error(), "at most 65535") {
+			t.Errorf("ParseParameters(%q) accepted a canvas too large for a GIF: %v", args, err)
+		}
+	}
+
+	if _, err := ParseParameters([]string{"-proximity", "0"}); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("ParseParameters accepted proximity 0: %v", err)
+	}
+	if _, err := ParseParameters([]string{"-noSuchFlag"}); ExitCode(err) != 2 {
+		t.Errorf("unknown flag: exit code %d, want 2 (%v)", ExitCode(err), err)
+	}
+	if ExitCode(flag.ErrHelp) != 0 || ExitCode(errors.New("disk full")) != 1 {
+		t.Errorf("exit codes of -help and run failures")
+	}
+}
+
+// TestStreamBoidsErrors checks that skies that cannot be simulated are refused and that a run that blows up stops with an error
+func TestStreamBoidsErrors(t *testing.T) {
+	visit := func(gen int, sky Sky) error { return nil }
+
+	sky := GenerateRandomSky(10, 100, 100, 1.0, 2.0, 0, 1.5, 1.0, 0.02, 1)
+	if err := StreamBoids(sky, 5, 1.0, false, visit); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("StreamBoids accepted proximity 0: %v", err)
+	}
+
+	sky = GenerateRandomSky(10, 100, 100, 1.0, 2.0, 50, 1.5, 1.0, 0.02, 1)
+	if err := StreamBoids(sky, 5, -1.0, false, visit); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("StreamBoids accepted a negative time step: %v", err)
+	}
+
+	// a huge separation factor and speed limit overflow the positions
+	sky.separationFactor, sky.maxBoidSpeed = 1e308, 1e308
+	sky.boundary = OpenBoundary
+	_, err := SimulateBoids(sky, 5, 1.0, false)
+	if !errors.Is(err, ErrNotFinite) || !strings.Contains(err.Error(), "not finite") || ExitCode(err) != 1 {
+		t.Errorf("SimulateBoids of an exploding sky: %v", err)
+	}
+
+	// UpdateSky reports the same blow-up instead of returning a sky of NaNs
+	stepped, err := sky, error(nil)
+	for gen := 1; gen <= 5 && err == nil; gen++ {
+		stepped, err = UpdateSky(stepped, 1.0)
+	}
+	if !errors.Is(err, ErrNotFinite) {
+		t.Errorf("UpdateSky of an exploding sky: %v", err)
+	}
+
+	// an unlimited speed is refused up front
+	sky.maxBoidSpeed = math.Inf(1)
+	if err := StreamBoids(sky, 5, 1.0, false, visit); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("StreamBoids accepted maxBoidSpeed +Inf: %v", err)
+	}
+}
+
+// TestStreamBoidsBlowUp runs flocks whose forces blow up between reflecting edges with every integrator,
+// and checks that each run ends, either with the error of a boid that is not finite or with every boid inside the sky
+func TestStreamBoidsBlowUp(t *testing.T) {
+	for _, scheme := range []IntegrationScheme{LegacyScheme, EulerScheme, SemiImplicitScheme, VerletScheme, RK4Scheme} {
+		for _, parallel := range []bool{false, true} {
+			params := DefaultParameters()
+			params.NumBoids, params.SkyWidth, params.Seed = 50, 500, 3
+			params.SeparationFactor, params.Boundary, params.Integrator = 1e300, ReflectBoundary, scheme
+			sky, err := InitialSky(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = StreamBoids(sky, 20, 1.0, parallel, func(gen int, sky Sky) error {
+				return CheckInsideSky(sky)
+			})
+			if err != nil && (!errors.Is(err, ErrNotFinite) || ExitCode(err) != 1) {
+				t.Errorf("%v integrator (parallel: %v): %v", scheme, parallel, err)
+			}
+		}
+	}
+}
+
+// TestValidateSkyPositions checks that boids outside a wrapping or reflecting sky are refused, and accepted past soft walls
+func TestValidateSkyPositions(t *testing.T) {
+	sky := GenerateRandomSky(10, 100, 100, 1.0, 2.0, 50, 1.5, 1.0, 0.02, 1)
+	sky.boids[3].position = OrderedPair{x: 5e6, y: 50}
+
+	for _, test := range []struct {
+		boundary BoundaryMode
+		valid    bool
+	}{{WrapBoundary, false}, {ReflectBoundary, false}, {SoftWallBoundary, true}, {OpenBoundary, true}} {
+		sky.boundary = test.boundary
+		if err := ValidateSky(sky); (err == nil) != test.valid {
+			t.Errorf("ValidateSky of a boid outside a sky with %v edges: %v", test.boundary, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Vision limits which neighbors a boid reacts to: a neighbor counts only if it lies inside a cone centered on the boid's heading.
+// Angles are the full width of a cone in degrees. Angle applies to every rule whose own angle is 0,
+// and BlindSpot is a cone directly behind the boid in which no rule sees anything.
+// The zero Vision sees all around, like a sky without vision limits.
+type Vision struct {
+	Angle           float64 `json:"angle"`
+	SeparationAngle float64 `json:"separationAngle"`
+	AlignmentAngle  float64 `json:"alignmentAngle"`
+	CohesionAngle   float64 `json:"cohesionAngle"`
+	BlindSpot       float64 `json:"blindSpot"`
+}
+
+// RuleAngles returns the width in degrees of the cones in which the separation, alignment and cohesion rules see neighbors
+func RuleAngles(vision Vision) (float64, float64, float64) {
+	return ConeAngle(vision, vision.SeparationAngle), ConeAngle(vision, vision.AlignmentAngle), ConeAngle(vision, vision.CohesionAngle)
+}
+
+// ConeAngle returns the width in degrees of the cone of a rule whose own angle is angle (0 for the shared angle of vision)
+func ConeAngle(vision Vision, angle float64) float64 {
+	if angle == 0 {
+		angle = vision.Angle
+	}
+	if angle == 0 {
+		angle = 360
+	}
+
+	// the blind spot takes its width out of every cone
+	return math.Min(angle, 360-vision.BlindSpot)
+}
+
+// InView reports whether pos lies inside the cone of width angle (in degrees) centered on the heading of boid b.
+// The edges of the cone are inside it. A cone of 360 degrees or more, and a boid that is not moving, see all around.
+func InView(b Boid, pos OrderedPair, angle float64) bool {
+	if angle >= 360 || (b.velocity.x == 0 && b.velocity.y == 0) {
+		return true
+	}
+
+	dx, dy := pos.x-b.position.x, pos.y-b.position.y
+	if dx == 0 && dy == 0 {
+		return true
+	}
+
+	// angle between the heading and the direction to pos, from 0 to 180 degrees
+	cross := b.velocity.x*dy - b.velocity.y*dx
+	dot := b.velocity.x*dx + b.velocity.y*dy
+	off_heading := math.Abs(math.Atan2(cross, dot)) * 180 / math.Pi
+
+	// a little slack, so that a neighbor exactly on the edge is not lost to rounding
+	return off_heading <= angle/2+1e-9
+}
+
+// ValidateVision checks that every angle of vision is a width from 0 to 360 degrees, and that the blind spot leaves something to see
+func ValidateVision(vision Vision) error {
+	var problems []error
+
+	for _, field := range []struct {
+		name  string
+		value float64
+	}{{"visionAngle", vision.Angle}, {"separationAngle", vision.SeparationAngle}, {"alignmentAngle", vision.AlignmentAngle}, {"cohesionAngle", vision.CohesionAngle}} {
+		if !(field.value >= 0 && field.value <= 360) {
+			problems = append(problems, fmt.Errorf("%s must be from 0 to 360 degrees, got %v", field.name, field.value))
+		}
+	}
+	if !(vision.BlindSpot >= 0 && vision.BlindSpot < 360) {
+		problems = append(problems, fmt.Errorf("blindSpot must be at least 0 and less than 360 degrees, got %v", vision.BlindSpot))
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// InViewTest holds the information for a test of the InView function
+type InViewTest struct {
+	b      Boid
+	pos    OrderedPair
+	angle  float64
+	result bool
+}
+
+// TestInView tests the InView function on neighbors on, just inside and just outside the edges of vision cones
+func TestInView(t *testing.T) {
+	tests := ReadInViewTests("Tests/InView/")
+	for _, test := range tests {
+		result := InView(test.b, test.pos, test.angle)
+
+		if result != test.result {
+			t.Errorf("InView(position: %v, velocity: %v, neighbor: %v, angle: %v) = %v, want %v",
+				test.b.position, test.b.velocity, test.pos, test.angle, result, test.result)
+		}
+	}
+}
+
+// ReadInViewTests takes as input a directory and returns a slice of InViewTest objects
+func ReadInViewTests(directory string) []InViewTest {
+	input_files := ReadDirectory(directory + "/input")
+	num_files := len(input_files)
+
+	tests := make([]InViewTest, num_files)
+	for i, input_file := range input_files {
+		fields := ReadFloatFields(directory+"input/"+input_file.Name(), 7)
+		tests[i].b = Boid{position: OrderedPair{x: fields[0], y: fields[1]}, velocity: OrderedPair{x: fields[2], y: fields[3]}}
+		tests[i].pos = OrderedPair{x: fields[4], y: fields[5]}
+		tests[i].angle = fields[6]
+	}
+
+	output_files := ReadDirectory(directory + "/output")
+	if len(output_files) != num_files {
+		panic("Error: number of input and output files do not match!")
+	}
+
+	for i, output_file := range output_files {
+		tests[i].result = ReadFloatFromFile(directory+"output/"+output_file.Name()) != 0
+	}
+
+	return tests
+}
+
+// TestRuleAngles checks that rules fall back to the shared angle and that the blind spot narrows every cone
+func TestRuleAngles(t *testing.T) {
+	tests := []struct {
+		vision                 Vision
+		separation, align, coh float64
+	}{
+		{Vision{}, 360, 360, 360},
+		{Vision{Angle: 270}, 270, 270, 270},
+		{Vision{Angle: 270, SeparationAngle: 360, CohesionAngle: 120}, 360, 270, 120},
+		{Vision{SeparationAngle: 360, AlignmentAngle: 180, BlindSpot: 60}, 300, 180, 300},
+	}
+
+	for _, test := range tests {
+		separation, align, coh := RuleAngles(test.vision)
+		if separation != test.separation || align != test.align || coh != test.coh {
+			t.Errorf("RuleAngles(%+v) = %v, %v, %v, want %v, %v, %v", test.vision, separation, align, coh, test.separation, test.align, test.coh)
+		}
+	}
+}
+
+// TestComputeNetForceVision checks that a neighbor behind a boid is ignored by the rules that cannot see it,
+// and that each rule is averaged over the neighbors it sees
+func TestComputeNetForceVision(t *testing.T) {
+	sky := Sky{width: 100, height: 100, proximity: 10, separationFactor: 1.5, alignmentFactor: 1.0, cohesionFactor: 0.2}
+	sky.boids = []Boid{
+		{id: 0, position: OrderedPair{x: 50, y: 50}, velocity: OrderedPair{x: 1, y: 0}},
+		{id: 1, position: OrderedPair{x: 54, y: 50}, velocity: OrderedPair{x: 0, y: 1}},  // ahead
+		{id: 2, position: OrderedPair{x: 45, y: 50}, velocity: OrderedPair{x: 0, y: -1}}, // behind
+	}
+	b, ahead, behind := sky.boids[0], sky.boids[1], sky.boids[2]
+
+	// separation sees all around, alignment and cohesion only forward
+	sky.vision = Vision{Angle: 180, SeparationAngle: 360}
+	result := ComputeNetForce(sky, b)
+
+	s1, s2 := ComputeSeparationForce(b, ahead, 1.5, 4), ComputeSeparationForce(b, behind, 1.5, 5)
+	a := ComputeAlignmentForce(b, ahead, 1.0, 4)
+	c := ComputeCohesionForce(b, ahead, 0.2, 4)
+	want := OrderedPair{x: (s1.x+s2.x)/2 + a.x + c.x, y: (s1.y+s2.y)/2 + a.y + c.y}
+
+	if math.Abs(result.x-want.x) > 1e-12 || math.Abs(result.y-want.y) > 1e-12 {
+		t.Errorf("ComputeNetForce with a forward cone = %v, want %v", result, want)
+	}
+
+	// a blind spot hides the boid behind from every rule
+	sky.vision = Vision{BlindSpot: 90}
+	only_ahead := CopySky(sky)
+	only_ahead.boids = only_ahead.boids[:2]
+	only_ahead.vision = Vision{}
+	if result, want := ComputeNetForce(sky, b), ComputeNetForce(only_ahead, b); result != want {
+		t.Errorf("ComputeNetForce with a blind spot = %v, want %v", result, want)
+	}
+}